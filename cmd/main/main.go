@@ -2,13 +2,31 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/vakhrushevk/cloudru/internal/app"
+	"github.com/vakhrushevk/cloudru/internal/config"
 )
 
+// defaultConfigPath путь к конфигурации, если он не задан флагом или переменной окружения
+const defaultConfigPath = "configs/config.yaml"
+
 func main() {
-	app, err := app.NewApp(context.Background(), "configs/config.yaml")
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "print" {
+		if err := printConfig(os.Args[3:]); err != nil {
+			log.Fatal("error printing config: ", err)
+		}
+		return
+	}
+
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	configPath := configFlag(flags)
+	flags.Parse(os.Args[1:])
+
+	app, err := app.NewApp(context.Background(), *configPath)
 
 	if err != nil {
 		log.Fatal("error creating app:", err)
@@ -16,3 +34,35 @@ func main() {
 
 	log.Fatal(app.Start())
 }
+
+// printConfig выводит действующую конфигурацию со скрытыми секретами: config print [-config path] [-format yaml|json]
+func printConfig(args []string) error {
+	flags := flag.NewFlagSet("config print", flag.ExitOnError)
+	configPath := configFlag(flags)
+	format := flags.String("format", config.FormatYAML, "формат вывода: yaml или json")
+	flags.Parse(args)
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	cfg, err = cfg.Printable()
+	if err != nil {
+		return err
+	}
+	data, err := config.Marshal(cfg, *format)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(os.Stdout, string(data))
+	return err
+}
+
+// configFlag добавляет флаг -config, значение по умолчанию берется из переменной окружения
+func configFlag(flags *flag.FlagSet) *string {
+	configPath := defaultConfigPath
+	if path, ok := os.LookupEnv(config.EnvConfigPath); ok {
+		configPath = path
+	}
+	return flags.String("config", configPath, "путь к файлу конфигурации (переменная окружения "+config.EnvConfigPath+")")
+}
@@ -0,0 +1,109 @@
+// Package admin предоставляет административный HTTP сервер для управления балансировщиком
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+var (
+	// ErrTokenRequired ошибка, если для административного сервера не задан токен
+	ErrTokenRequired = errors.New("admin token is required")
+)
+
+// Server административный HTTP сервер на отдельном порту.
+// Все запросы требуют заголовок Authorization: Bearer <token>.
+type Server struct {
+	mux        *http.ServeMux
+	httpServer *http.Server
+	token      string
+}
+
+// New создает новый административный сервер
+func New(cfg config.AdminConfig) (*Server, error) {
+	if cfg.Token == "" {
+		return nil, ErrTokenRequired
+	}
+
+	s := &Server{
+		mux:   http.NewServeMux(),
+		token: cfg.Token,
+	}
+	s.httpServer = &http.Server{
+		Addr:    net.JoinHostPort(cfg.ListenAddr, strconv.Itoa(cfg.ListenPort)),
+		Handler: s.authMiddleware(s.mux),
+	}
+
+	return s, nil
+}
+
+// Handle регистрирует обработчик для шаблона pattern
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// HandleFunc регистрирует функцию-обработчик для шаблона pattern
+func (s *Server) HandleFunc(pattern string, handler http.HandlerFunc) {
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// Start запускает сервер
+func (s *Server) Start() error {
+	slog.Info("Starting admin server", "addr", s.httpServer.Addr)
+	return s.httpServer.ListenAndServe()
+}
+
+// Shutdown останавливает сервер
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.httpServer.Shutdown(ctx)
+}
+
+// authMiddleware проверяет токен доступа
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeJSON записывает v в ответ в формате JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode admin response", "error", err)
+	}
+}
+
+// writeError записывает ошибку в ответ в том же формате, что и ответы rate limiter
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{
+		"code":  strconv.Itoa(status),
+		"error": err.Error(),
+	})
+}
+
+// readJSON декодирует тело запроса в v
+func readJSON(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,269 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
+	roundrobin "github.com/vakhrushevk/cloudru/internal/balancer/roundRobin"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+	"github.com/vakhrushevk/cloudru/pkg/logger"
+)
+
+const testToken = "0123456789abcdef-token"
+
+// newTestServer создает административный сервер без запуска слушателя
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	s, err := New(config.AdminConfig{ListenAddr: "127.0.0.1", ListenPort: 8081, Token: testToken})
+	require.NoError(t, err)
+	return s
+}
+
+// do выполняет запрос к серверу с токеном администратора
+func do(s *Server, method, target, body string) *httptest.ResponseRecorder {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	s.HandleFunc("GET /ping", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	assert.Equal(t, "127.0.0.1:8081", s.httpServer.Addr)
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{name: "missing", want: http.StatusUnauthorized},
+		{name: "wrong scheme", header: "Basic " + testToken, want: http.StatusUnauthorized},
+		{name: "wrong token", header: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "correct", header: "bearer " + testToken, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			s.httpServer.Handler.ServeHTTP(rec, req)
+			assert.Equal(t, tt.want, rec.Code)
+		})
+	}
+
+	_, err := New(config.AdminConfig{ListenPort: 8081})
+	assert.ErrorIs(t, err, ErrTokenRequired)
+}
+
+func TestOverrides(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	limiter := ratelimit.NewLimiter(ctx, repo, repo, config.BucketConfig{Capacity: 10, RefilRate: 1, RefilTime: time.Second})
+	s := newTestServer(t)
+	s.RegisterOverrides(limiter)
+
+	rec := do(s, http.MethodPut, "/overrides/ip:10.0.0.1", `{"capacity": 100, "refil_rate": 5}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+	rec = do(s, http.MethodGet, "/overrides/ip:10.0.0.1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got model.Override
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, model.Override{Key: "ip:10.0.0.1", Capacity: 100, RefilRate: 5}, got)
+
+	rec = do(s, http.MethodGet, "/overrides", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var list []model.Override
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&list))
+	assert.Len(t, list, 1)
+
+	assert.Equal(t, http.StatusBadRequest, do(s, http.MethodPut, "/overrides/ip:10.0.0.2", `{"capacity": 0}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, http.MethodPut, "/overrides/ip:10.0.0.2", `{"unknown": 1}`).Code)
+
+	assert.Equal(t, http.StatusNoContent, do(s, http.MethodDelete, "/overrides/ip:10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(s, http.MethodGet, "/overrides/ip:10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(s, http.MethodDelete, "/overrides/ip:10.0.0.1", "").Code)
+
+	disabled := newTestServer(t)
+	disabled.RegisterOverrides(ratelimit.NewLimiter(ctx, repo, nil, config.BucketConfig{RefilTime: time.Second}))
+	assert.Equal(t, http.StatusNotImplemented, do(disabled, http.MethodGet, "/overrides", "").Code)
+}
+
+// backendService управляет бэкендами балансировщика так же, как приложение, без истории конфигураций
+type backendService struct {
+	rb *roundrobin.Balancer
+}
+
+func (s backendService) Backends(context.Context) []backend.Status { return s.rb.Backends() }
+
+func (s backendService) AddBackend(_ context.Context, cfg config.BackendConfig) error {
+	if err := config.ValidateBackend(cfg); err != nil {
+		return err
+	}
+	return s.rb.AddBackend(cfg)
+}
+
+func (s backendService) RemoveBackend(_ context.Context, url string) error {
+	return s.rb.RemoveBackend(url)
+}
+
+func (s backendService) DrainBackend(_ context.Context, url string, drain bool) error {
+	return s.rb.Drain(url, drain)
+}
+
+func (s backendService) HealthCheck(context.Context) []backend.Status {
+	s.rb.HealthCheck()
+	return s.rb.Backends()
+}
+
+// decodeBackends разбирает ответ со списком бэкендов
+func decodeBackends(t *testing.T, rec *httptest.ResponseRecorder) []backend.Status {
+	t.Helper()
+	var statuses []backend.Status
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&statuses))
+	return statuses
+}
+
+func TestBackends(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	alive := httptest.NewServer(http.NotFoundHandler())
+	defer alive.Close()
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	rb, err := roundrobin.New(ctx, config.BalancerConfig{
+		Backends:            []config.BackendConfig{{URL: alive.URL}},
+		HealthCheckInterval: time.Hour,
+	}, config.RetryConfig{})
+	require.NoError(t, err)
+	s := newTestServer(t)
+	s.RegisterBackends(backendService{rb: rb})
+
+	rec := do(s, http.MethodPost, "/backends", `{"url": "`+dead.URL+`", "weight": 2}`)
+	require.Equal(t, http.StatusCreated, rec.Code, rec.Body.String())
+	statuses := decodeBackends(t, rec)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, 2, statuses[1].Weight)
+
+	assert.Equal(t, http.StatusConflict, do(s, http.MethodPost, "/backends", `{"url": "`+dead.URL+`/"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(s, http.MethodPost, "/backends", `{"url": "backend:8000"}`).Code)
+
+	rec = do(s, http.MethodPost, "/backends/drain?url="+alive.URL, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, decodeBackends(t, rec)[0].Draining)
+	rec = do(s, http.MethodPost, "/backends/undrain?url="+alive.URL, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.False(t, decodeBackends(t, rec)[0].Draining)
+	assert.Equal(t, http.StatusNotFound, do(s, http.MethodPost, "/backends/drain?url=http://unknown", "").Code)
+
+	rec = do(s, http.MethodPost, "/backends/health-check", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	statuses = decodeBackends(t, rec)
+	assert.True(t, statuses[0].Alive)
+	assert.False(t, statuses[1].Alive)
+	assert.NotEmpty(t, statuses[1].LastError)
+
+	assert.Equal(t, http.StatusNoContent, do(s, http.MethodDelete, "/backends?url="+dead.URL, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(s, http.MethodDelete, "/backends?url="+dead.URL, "").Code)
+	rec = do(s, http.MethodGet, "/backends", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, decodeBackends(t, rec), 1)
+}
+
+func TestLogLevel(t *testing.T) {
+	prev := logger.Level()
+	t.Cleanup(func() { require.NoError(t, logger.SetLevel(prev)) })
+
+	s := newTestServer(t)
+	s.RegisterLogLevel()
+
+	rec := do(s, http.MethodPut, "/log-level", `{"level": "DEBUG"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level": "debug"}`, rec.Body.String())
+
+	rec = do(s, http.MethodGet, "/log-level", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"level": "debug"}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, do(s, http.MethodPut, "/log-level", `{"level": "trace"}`).Code)
+	assert.Equal(t, "debug", logger.Level())
+}
+
+func TestBuckets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	require.NoError(t, repo.CreateBucket(ctx, "policy:login:ip:10.0.0.1", 5, 1, 3))
+	s := newTestServer(t)
+	s.RegisterBuckets(repo)
+
+	rec := do(s, http.MethodGet, "/buckets/policy:login:ip:10.0.0.1", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got bucketResponse
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, "policy:login:ip:10.0.0.1", got.Key)
+	assert.Equal(t, 3, got.Tokens)
+	assert.Equal(t, 5, got.Capacity)
+	assert.Equal(t, 1, got.RefilRate)
+
+	assert.Equal(t, http.StatusNotFound, do(s, http.MethodGet, "/buckets/ip:10.0.0.2", "").Code)
+}
+
+// reloadService возвращает заданный результат перезагрузки
+type reloadService struct {
+	result config.ReloadResult
+	err    error
+}
+
+func (s reloadService) ReloadConfig(context.Context) (config.ReloadResult, error) {
+	return s.result, s.err
+}
+
+func TestReload(t *testing.T) {
+	s := newTestServer(t)
+	s.RegisterReload(reloadService{result: config.ReloadResult{
+		Applied:         []string{"bucket.capacity"},
+		RestartRequired: []string{"http.listen_port"},
+	}})
+
+	rec := do(s, http.MethodPost, "/config/reload", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var got config.ReloadResult
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&got))
+	assert.Equal(t, []string{"bucket.capacity"}, got.Applied)
+	assert.Equal(t, []string{"http.listen_port"}, got.RestartRequired)
+
+	invalid := newTestServer(t)
+	invalid.RegisterReload(reloadService{err: errors.New("invalid config: bucket.refil_time: must be positive")})
+	rec = do(invalid, http.MethodPost, "/config/reload", "")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "bucket.refil_time")
+}
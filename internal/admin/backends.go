@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+// BackendService управление бэкендами работающего балансировщика
+type BackendService interface {
+	Backends(ctx context.Context) []backend.Status
+	AddBackend(ctx context.Context, cfg config.BackendConfig) error
+	RemoveBackend(ctx context.Context, url string) error
+	DrainBackend(ctx context.Context, url string, drain bool) error
+	HealthCheck(ctx context.Context) []backend.Status
+}
+
+// backendRequest тело запроса на добавление бэкенда
+type backendRequest struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// RegisterBackends регистрирует обработчики бэкендов.
+// Бэкенд задается адресом в параметре url, например ?url=http://backend:8000.
+//
+//	GET    /backends               бэкенды, их доступность, веса и статистика
+//	POST   /backends               добавить бэкенд {"url": "...", "weight": 1}
+//	DELETE /backends?url=          удалить бэкенд
+//	POST   /backends/drain?url=    не направлять на бэкенд новые запросы
+//	POST   /backends/undrain?url=  вернуть бэкенд в балансировку
+//	POST   /backends/health-check  проверить доступность бэкендов сейчас
+func (s *Server) RegisterBackends(svc BackendService) {
+	s.HandleFunc("GET /backends", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, svc.Backends(r.Context()))
+	})
+
+	s.HandleFunc("POST /backends", func(w http.ResponseWriter, r *http.Request) {
+		var req backendRequest
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		err := svc.AddBackend(r.Context(), config.BackendConfig{URL: req.URL, Weight: req.Weight})
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, svc.Backends(r.Context()))
+	})
+
+	s.HandleFunc("DELETE /backends", func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.RemoveBackend(r.Context(), r.URL.Query().Get("url")); err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	drain := func(drain bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if err := svc.DrainBackend(r.Context(), r.URL.Query().Get("url"), drain); err != nil {
+				writeBackendError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, svc.Backends(r.Context()))
+		}
+	}
+	s.HandleFunc("POST /backends/drain", drain(true))
+	s.HandleFunc("POST /backends/undrain", drain(false))
+
+	s.HandleFunc("POST /backends/health-check", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, svc.HealthCheck(r.Context()))
+	})
+}
+
+// writeBackendError записывает ошибку управления бэкендом с подходящим статусом
+func writeBackendError(w http.ResponseWriter, err error) {
+	var validationErrs config.ValidationErrors
+	switch {
+	case errors.Is(err, backend.ErrBackendNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, backend.ErrBackendExists):
+		writeError(w, http.StatusConflict, err)
+	case errors.As(err, &validationErrs):
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
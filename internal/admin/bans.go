@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// BanService просмотр и снятие временных блокировок клиентов
+type BanService interface {
+	Bans(ctx context.Context) ([]model.Ban, error)
+	Unban(ctx context.Context, key string) error
+}
+
+// RegisterBans регистрирует обработчики блокировок.
+// Ключ совпадает с ключом клиента, например ip:10.0.0.1.
+//
+//	GET    /bans        действующие блокировки
+//	DELETE /bans/{key}  снять блокировку и сбросить ее длительность
+func (s *Server) RegisterBans(svc BanService) {
+	s.HandleFunc("GET /bans", func(w http.ResponseWriter, r *http.Request) {
+		bans, err := svc.Bans(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, bans)
+	})
+
+	s.HandleFunc("DELETE /bans/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		err := svc.Unban(r.Context(), r.PathValue("key"))
+		switch {
+		case errors.Is(err, repository.ErrBanNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
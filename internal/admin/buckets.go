@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// BucketService просмотр бакетов ограничения запросов
+type BucketService interface {
+	Bucket(ctx context.Context, key string) (*model.Bucket, error)
+}
+
+// bucketResponse состояние бакета
+type bucketResponse struct {
+	Key        string    `json:"key"`
+	Tokens     int       `json:"tokens"`
+	Capacity   int       `json:"capacity"`
+	RefilRate  int       `json:"refil_rate"`
+	LastRefill time.Time `json:"last_refill"`
+}
+
+// RegisterBuckets регистрирует обработчик просмотра бакетов.
+// Ключ совпадает с ключом бакета, например ip:10.0.0.1, для именованных политик - policy:<name>:ip:10.0.0.1.
+//
+//	GET /buckets/{key}  токены, емкость и скорость пополнения бакета
+func (s *Server) RegisterBuckets(svc BucketService) {
+	s.HandleFunc("GET /buckets/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		key := r.PathValue("key")
+		b, err := svc.Bucket(r.Context(), key)
+		switch {
+		case errors.Is(err, repository.ErrBucketNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		default:
+			writeJSON(w, http.StatusOK, bucketResponse{
+				Key:        key,
+				Tokens:     b.Tokens,
+				Capacity:   b.Capacity,
+				RefilRate:  b.RefilRate,
+				LastRefill: b.LastRefill,
+			})
+		}
+	})
+}
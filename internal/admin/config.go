@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+// ReloadService перезагрузка конфигурации
+type ReloadService interface {
+	ReloadConfig(ctx context.Context) (config.ReloadResult, error)
+}
+
+// RegisterReload регистрирует обработчик перезагрузки конфигурации.
+// Конфигурация с ошибками не применяется, ошибки возвращаются в ответе.
+//
+//	POST /config/reload  перечитать файл конфигурации, ответ - примененные поля
+//	                     и поля, которые вступят в силу после перезапуска
+func (s *Server) RegisterReload(svc ReloadService) {
+	s.HandleFunc("POST /config/reload", func(w http.ResponseWriter, r *http.Request) {
+		result, err := svc.ReloadConfig(r.Context())
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	})
+}
@@ -0,0 +1,75 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/history"
+)
+
+// RollbackService откат конфигурации к версии из истории
+type RollbackService interface {
+	Rollback(ctx context.Context, id int) (config.ReloadResult, error)
+}
+
+// revisionResponse версия конфигурации вместе с самой конфигурацией
+type revisionResponse struct {
+	history.Revision
+	Config json.RawMessage `json:"config"`
+}
+
+// RegisterHistory регистрирует обработчики истории конфигураций.
+// Секреты в конфигурациях скрыты.
+//
+//	GET  /config/history                версии от старых к новым, измененные поля и бэкенды
+//	GET  /config/history/{id}           версия вместе с конфигурацией
+//	POST /config/history/{id}/rollback  применить поля версии, изменяемые без перезапуска
+func (s *Server) RegisterHistory(h *history.History, svc RollbackService) {
+	s.HandleFunc("GET /config/history", func(w http.ResponseWriter, _ *http.Request) {
+		revisions := h.Revisions()
+		if revisions == nil {
+			revisions = []history.Revision{}
+		}
+		writeJSON(w, http.StatusOK, revisions)
+	})
+
+	s.HandleFunc("GET /config/history/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid revision id"))
+			return
+		}
+		rev, err := h.Revision(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		data, err := config.Marshal(rev.Config, config.FormatJSON)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, revisionResponse{Revision: rev, Config: data})
+	})
+
+	s.HandleFunc("POST /config/history/{id}/rollback", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("invalid revision id"))
+			return
+		}
+		result, err := svc.Rollback(r.Context(), id)
+		switch {
+		case errors.Is(err, history.ErrRevisionNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		default:
+			writeJSON(w, http.StatusOK, result)
+		}
+	})
+}
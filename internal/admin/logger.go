@@ -0,0 +1,36 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/vakhrushevk/cloudru/pkg/logger"
+)
+
+// logLevel тело запроса и ответа уровня логирования
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+// RegisterLogLevel регистрирует обработчики уровня логирования.
+// Измененный уровень действует до перезапуска или изменения секции logger в конфигурации.
+//
+//	GET /log-level  текущий уровень
+//	PUT /log-level  изменить уровень {"level": "debug"}
+func (s *Server) RegisterLogLevel() {
+	s.HandleFunc("GET /log-level", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, logLevel{Level: logger.Level()})
+	})
+
+	s.HandleFunc("PUT /log-level", func(w http.ResponseWriter, r *http.Request) {
+		var req logLevel
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := logger.SetLevel(req.Level); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, logLevel{Level: logger.Level()})
+	})
+}
@@ -0,0 +1,13 @@
+package admin
+
+import (
+	"github.com/vakhrushevk/cloudru/internal/metrics"
+)
+
+// RegisterMetrics регистрирует обработчик метрик Prometheus.
+// Prometheus передает токен в настройке authorization задания.
+//
+//	GET /metrics  метрики запросов, бэкендов, проверок доступности, ограничения запросов и Redis
+func (s *Server) RegisterMetrics() {
+	s.Handle("GET /metrics", metrics.Handler())
+}
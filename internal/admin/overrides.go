@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// OverrideService управление переопределениями лимитов для отдельных клиентов
+type OverrideService interface {
+	Overrides(ctx context.Context) ([]model.Override, error)
+	Override(ctx context.Context, key string) (*model.Override, error)
+	SetOverride(ctx context.Context, override model.Override) error
+	DeleteOverride(ctx context.Context, key string) error
+}
+
+// overrideRequest тело запроса на создание или обновление переопределения
+type overrideRequest struct {
+	Capacity  int  `json:"capacity"`
+	RefilRate int  `json:"refil_rate"`
+	Unlimited bool `json:"unlimited"`
+}
+
+// RegisterOverrides регистрирует обработчики переопределений лимитов.
+// Ключ совпадает с ключом бакета, например header:x-api-key:abc или ip:10.0.0.1.
+//
+//	GET    /overrides        список переопределений
+//	GET    /overrides/{key}  переопределение для ключа
+//	PUT    /overrides/{key}  создать или обновить переопределение
+//	DELETE /overrides/{key}  удалить переопределение
+func (s *Server) RegisterOverrides(svc OverrideService) {
+	s.HandleFunc("GET /overrides", func(w http.ResponseWriter, r *http.Request) {
+		overrides, err := svc.Overrides(r.Context())
+		if err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, overrides)
+	})
+
+	s.HandleFunc("GET /overrides/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		override, err := svc.Override(r.Context(), r.PathValue("key"))
+		if err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, override)
+	})
+
+	s.HandleFunc("PUT /overrides/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		var req overrideRequest
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		override := model.Override{
+			Key:       r.PathValue("key"),
+			Capacity:  req.Capacity,
+			RefilRate: req.RefilRate,
+			Unlimited: req.Unlimited,
+		}
+		if err := svc.SetOverride(r.Context(), override); err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, override)
+	})
+
+	s.HandleFunc("DELETE /overrides/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.DeleteOverride(r.Context(), r.PathValue("key")); err != nil {
+			writeOverrideError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// writeOverrideError преобразует ошибку в HTTP статус
+func writeOverrideError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrOverrideNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ratelimit.ErrInvalidOverride):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, ratelimit.ErrOverridesDisabled):
+		writeError(w, http.StatusNotImplemented, err)
+	case errors.Is(err, repository.ErrStoreUnavailable):
+		writeError(w, http.StatusServiceUnavailable, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"net/http"
+
+	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
+)
+
+// policyResponse состояние политики ограничения запросов
+type policyResponse struct {
+	Name         string `json:"name"`
+	Mode         string `json:"mode"`
+	ShadowDenied uint64 `json:"shadow_denied"`
+}
+
+// RegisterPolicies регистрирует обработчик просмотра политик ограничения запросов.
+//
+//	GET /policies  политики в порядке проверки, их режим и количество запросов,
+//	               которые политики в режиме shadow отклонили бы
+func (s *Server) RegisterPolicies(policies []*ratelimit.Policy) {
+	s.HandleFunc("GET /policies", func(w http.ResponseWriter, _ *http.Request) {
+		resp := make([]policyResponse, 0, len(policies))
+		for _, p := range policies {
+			resp = append(resp, policyResponse{
+				Name:         p.Name(),
+				Mode:         p.Mode(),
+				ShadowDenied: p.ShadowDenied(),
+			})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	})
+}
@@ -0,0 +1,38 @@
+package admin
+
+import (
+	"context"
+	"net/http"
+
+	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
+)
+
+// QuotaService просмотр и сброс использования квот клиентами
+type QuotaService interface {
+	Usage(ctx context.Context, key string) ([]ratelimit.QuotaUsage, error)
+	ResetUsage(ctx context.Context, key string) error
+}
+
+// RegisterQuotas регистрирует обработчики квот.
+// Ключ совпадает с ключом клиента, например header:x-api-key:abc.
+//
+//	GET    /quotas/{key}  использование квот за текущие периоды
+//	DELETE /quotas/{key}  сбросить использование квот за текущие периоды
+func (s *Server) RegisterQuotas(svc QuotaService) {
+	s.HandleFunc("GET /quotas/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		usage, err := svc.Usage(r.Context(), r.PathValue("key"))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, usage)
+	})
+
+	s.HandleFunc("DELETE /quotas/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		if err := svc.ResetUsage(r.Context(), r.PathValue("key")); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -2,10 +2,15 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"sync"
+	"time"
 
+	"github.com/vakhrushevk/cloudru/internal/accesslog"
+	"github.com/vakhrushevk/cloudru/internal/admin"
 	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
 )
 
@@ -15,6 +20,10 @@ var globalConfigPath string
 type App struct {
 	serviceProvider *serviceProvider
 	httpServer      *http.Server
+	adminServer     *admin.Server
+	policies        []*ratelimit.Policy
+
+	reloadMu sync.Mutex
 }
 
 // NewApp создает новый App
@@ -41,25 +50,99 @@ func (a *App) initServiceProvider(ctx context.Context) error {
 
 // initHttpServer инициализирует http сервер
 func (a *App) initHttpServer(ctx context.Context) error {
+	cfg := a.serviceProvider.Config().RateLimitConfig
+	extractor, err := ratelimit.NewKeyExtractor(cfg.Key)
+	if err != nil {
+		return fmt.Errorf("error creating rate limit key extractor: %w", err)
+	}
+
+	policies, err := ratelimit.NewPolicies(ctx, cfg.Policies,
+		a.serviceProvider.BucketRepository(ctx), a.serviceProvider.WindowRepository(ctx), cfg.Hybrid)
+	if err != nil {
+		return fmt.Errorf("error creating rate limit policies: %w", err)
+	}
+
+	var limiter ratelimit.Algorithm = a.serviceProvider.Limiter(ctx)
+	if cfg.Hybrid.Enabled {
+		limiter = ratelimit.NewHybridLimiter(ctx, a.serviceProvider.Limiter(ctx), cfg.Hybrid)
+	}
+	policies = append(policies, ratelimit.NewDefaultPolicy(limiter, extractor))
+	a.policies = policies
+
+	var concurrencyLimiter *ratelimit.ConcurrencyLimiter
+	if concurrency := a.serviceProvider.Config().ConcurrencyConfig; concurrency.MaxInFlight > 0 {
+		concurrencyExtractor := extractor
+		if concurrency.Key.Type != "" {
+			concurrencyExtractor, err = ratelimit.NewKeyExtractor(concurrency.Key)
+			if err != nil {
+				return fmt.Errorf("error creating concurrency key extractor: %w", err)
+			}
+		}
+		concurrencyLimiter = ratelimit.NewConcurrencyLimiter(a.serviceProvider.ConcurrencyRepository(ctx),
+			concurrencyExtractor, concurrency, cfg.OnStoreError)
+	}
+	backends := a.serviceProvider.Balancer(ctx).BalanceHandler()
+	handler := limitUsage(backends, a.serviceProvider.QuotaLimiter(ctx), concurrencyLimiter)
+	costs, err := ratelimit.NewCosts(cfg.Cost)
+	if err != nil {
+		return fmt.Errorf("error creating rate limit costs: %w", err)
+	}
+	handler = ratelimit.Middleware(policies, costs, a.serviceProvider.PenaltyBox(ctx), cfg)(handler)
+	if filter := a.serviceProvider.IPFilter(ctx); filter != nil {
+		// клиенты из списка исключений обходят все ограничители
+		handler = filter.Middleware(handler, backends)
+	}
+	handler = accesslog.Middleware(handler)
+	handler = a.serviceProvider.ClientIPResolver().Middleware(handler)
+
 	mux := http.NewServeMux()
-	mux.Handle("/", ratelimit.Middleware(
-		a.serviceProvider.Limiter(ctx))(
-		a.serviceProvider.Balancer(ctx).BalanceHandler()))
+	mux.Handle("/", handler)
 
+	httpConfig := a.serviceProvider.Config().HTTPConfig
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", a.serviceProvider.Config().HTTPConfig.ListenPort),
-		Handler: mux,
+		Addr:         fmt.Sprintf(":%d", httpConfig.ListenPort),
+		Handler:      mux,
+		ReadTimeout:  time.Duration(httpConfig.ReadTimeout) * time.Second,
+		WriteTimeout: time.Duration(httpConfig.WriteTimeout) * time.Second,
 	}
 	a.httpServer = server
 
 	return nil
 }
 
+// limitUsage оборачивает handler ограничителями квот и одновременных запросов, каждый из них может быть nil.
+// Одновременные запросы проверяются первыми, чтобы отклоненные запросы не расходовали квоту
+func limitUsage(handler http.Handler, quotas *ratelimit.QuotaLimiter, concurrency *ratelimit.ConcurrencyLimiter) http.Handler {
+	if quotas != nil {
+		handler = quotas.Middleware(handler)
+	}
+	if concurrency != nil {
+		handler = concurrency.Middleware(handler)
+	}
+	return handler
+}
+
+// initAdminServer инициализирует административный сервер
+func (a *App) initAdminServer(ctx context.Context) error {
+	a.adminServer = a.serviceProvider.AdminServer(ctx)
+	if a.adminServer != nil {
+		a.adminServer.RegisterPolicies(a.policies)
+		a.adminServer.RegisterHistory(a.serviceProvider.History(), a)
+		a.adminServer.RegisterBackends(a)
+		a.adminServer.RegisterReload(a)
+	}
+	return nil
+}
+
 // initDeps инициализирует зависимости
 func (a *App) initDeps(ctx context.Context) error {
 	inits := []func(context.Context) error{
 		a.initServiceProvider,
 		a.initHttpServer,
+		a.initAdminServer,
+		a.initHistory,
+		a.initConfigWatcher,
+		a.initBackendsWatcher,
 	}
 
 	for _, f := range inits {
@@ -74,6 +157,14 @@ func (a *App) initDeps(ctx context.Context) error {
 
 // Start запускает сервер
 func (a *App) Start() error {
+	if a.adminServer != nil {
+		go func() {
+			if err := a.adminServer.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Admin server stopped", "error", err)
+			}
+		}()
+	}
+
 	slog.Info("Starting server on port", "port", a.serviceProvider.Config().HTTPConfig.ListenPort)
 	return a.httpServer.ListenAndServe()
 }
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+)
+
+func TestLimitUsageOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	extractor := ratelimit.RemoteIPExtractor()
+	quotas, err := ratelimit.NewQuotaLimiter(repo, extractor, config.QuotaConfig{
+		Limits: []config.QuotaLimitConfig{{Period: "day", Limit: 10}},
+	}, "")
+	require.NoError(t, err)
+	concurrency := ratelimit.NewConcurrencyLimiter(repo, extractor, config.ConcurrencyConfig{MaxInFlight: 1, LeaseTTL: time.Minute}, "")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := limitUsage(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}), quotas, concurrency)
+
+	do := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- do() }()
+	<-started
+
+	// запрос сверх лимита одновременных запросов не расходует квоту
+	assert.Equal(t, http.StatusTooManyRequests, do())
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+
+	usage, err := quotas.Usage(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	require.Len(t, usage, 1)
+	assert.EqualValues(t, 1, usage[0].Used)
+}
+
+func TestReloadConfigBucket(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const base = `
+rate_limit:
+  storage: memory
+redis:
+  addr: localhost:6379
+balancer:
+  backends:
+    - url: http://backend:8000
+bucket:
+  refil_rate: 1
+  refil_time: 1h
+`
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(base+"  capacity: 5\n"), 0o644))
+	globalConfigPath = path
+	a := &App{serviceProvider: &serviceProvider{}}
+
+	limiter := a.serviceProvider.Limiter(ctx)
+	require.True(t, limiter.Allow(ctx, "ip:10.0.0.1", 1).Allowed)
+
+	require.NoError(t, os.WriteFile(path, []byte(base+"  capacity: 20\n"), 0o644))
+	result, err := a.ReloadConfig(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, result.Applied, "bucket.capacity")
+
+	// существующий бакет получает новые лимиты при перезагрузке, а не при следующем запросе
+	b, err := a.serviceProvider.BucketRepository(ctx).Bucket(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 20, b.Capacity)
+	assert.Equal(t, 20, limiter.Allow(ctx, "ip:10.0.0.1", 1).Limit)
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"context"
+	"slices"
+
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/history"
+)
+
+// Backends возвращает состояние и статистику бэкендов
+func (a *App) Backends(ctx context.Context) []backend.Status {
+	return a.serviceProvider.Balancer(ctx).Backends()
+}
+
+// AddBackend добавляет бэкенд в работающий балансировщик.
+// Изменение попадает в историю конфигураций, но не в файлы и действует до изменения бэкендов в них
+func (a *App) AddBackend(ctx context.Context, cfg config.BackendConfig) error {
+	if err := config.ValidateBackend(cfg); err != nil {
+		return err
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if err := a.serviceProvider.Balancer(ctx).AddBackend(cfg); err != nil {
+		return err
+	}
+	current := a.serviceProvider.Config()
+	next := *current
+	next.BalancerConfig.Backends = append(slices.Clone(current.BalancerConfig.Backends), cfg)
+	a.serviceProvider.setConfig(&next)
+	a.recordConfig(history.SourceAdmin, &next)
+	return nil
+}
+
+// RemoveBackend удаляет бэкенд из работающего балансировщика, начатые запросы к нему завершаются.
+// Изменение попадает в историю конфигураций, но не в файлы и действует до изменения бэкендов в них
+func (a *App) RemoveBackend(ctx context.Context, url string) error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	if err := a.serviceProvider.Balancer(ctx).RemoveBackend(url); err != nil {
+		return err
+	}
+	current := a.serviceProvider.Config()
+	next := *current
+	next.BalancerConfig.Backends = slices.DeleteFunc(slices.Clone(current.BalancerConfig.Backends), func(b config.BackendConfig) bool {
+		return config.NormalizeBackendURL(b.URL) == config.NormalizeBackendURL(url)
+	})
+	a.serviceProvider.setConfig(&next)
+	a.recordConfig(history.SourceAdmin, &next)
+	return nil
+}
+
+// DrainBackend выводит бэкенд из балансировки без удаления или возвращает его
+func (a *App) DrainBackend(ctx context.Context, url string, drain bool) error {
+	return a.serviceProvider.Balancer(ctx).Drain(url, drain)
+}
+
+// HealthCheck проверяет доступность бэкендов и возвращает их состояние
+func (a *App) HealthCheck(ctx context.Context) []backend.Status {
+	b := a.serviceProvider.Balancer(ctx)
+	b.HealthCheck()
+	return b.Backends()
+}
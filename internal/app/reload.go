@@ -0,0 +1,147 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"slices"
+
+	"github.com/vakhrushevk/cloudru/internal/balancer"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/history"
+	"github.com/vakhrushevk/cloudru/pkg/logger"
+)
+
+// ReloadConfig перечитывает файл конфигурации и применяет изменения, которые можно применить
+// без перезапуска. Конфигурация с ошибками не применяется целиком, ошибки возвращаются в config.ValidationErrors
+func (a *App) ReloadConfig(ctx context.Context) (config.ReloadResult, error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	next, err := config.LoadConfig(globalConfigPath)
+	if err != nil {
+		return config.ReloadResult{}, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	current := a.serviceProvider.Config()
+	var result config.ReloadResult
+	for _, path := range config.Diff(current, next) {
+		if config.RequiresRestart(path) {
+			result.RestartRequired = append(result.RestartRequired, path)
+		} else {
+			result.Applied = append(result.Applied, path)
+		}
+	}
+
+	if len(result.Applied) > 0 {
+		applied := current.WithLive(next)
+		a.applyConfig(ctx, current, applied)
+		a.serviceProvider.setConfig(applied)
+		a.recordConfig(history.SourceReload, applied)
+	}
+
+	return result, nil
+}
+
+// Rollback применяет поля версии id из истории, изменяемые без перезапуска.
+// Бэкенды из backends_file действуют до следующего изменения файла
+func (a *App) Rollback(ctx context.Context, id int) (config.ReloadResult, error) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	rev, err := a.serviceProvider.History().Revision(id)
+	if err != nil {
+		return config.ReloadResult{}, err
+	}
+
+	current := a.serviceProvider.Config()
+	applied := current.WithLive(rev.Config)
+	result := config.ReloadResult{Applied: config.Diff(current, applied)}
+	if len(result.Applied) > 0 {
+		a.applyConfig(ctx, current, applied)
+		a.serviceProvider.setConfig(applied)
+		if _, err := a.serviceProvider.History().RecordRollback(id, applied); err != nil {
+			slog.Error("Failed to record config revision", "error", err)
+		}
+	}
+	slog.Info("Config rolled back", "revision", id, "applied", result.Applied)
+
+	return result, nil
+}
+
+// reloadBackends применяет бэкенды из измененного backends_file
+func (a *App) reloadBackends(ctx context.Context, backends []config.BackendConfig) {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	current := a.serviceProvider.Config()
+	next := *current
+	next.BalancerConfig.Backends = backends
+	a.serviceProvider.Balancer(ctx).SetBackends(backends)
+	a.serviceProvider.setConfig(&next)
+	a.recordConfig(history.SourceBackendsFile, &next)
+}
+
+// recordConfig добавляет примененную конфигурацию в историю
+func (a *App) recordConfig(source string, cfg *config.Config) {
+	if _, err := a.serviceProvider.History().Record(source, cfg); err != nil {
+		slog.Error("Failed to record config revision", "error", err)
+	}
+}
+
+// applyConfig применяет изменения, которые можно применить без перезапуска, к работающим компонентам
+func (a *App) applyConfig(ctx context.Context, current, applied *config.Config) {
+	if applied.LoggerConfig != current.LoggerConfig {
+		logger.Init(&applied.LoggerConfig)
+	}
+	if !reflect.DeepEqual(applied.BucketConfig, current.BucketConfig) {
+		if err := a.serviceProvider.Limiter(ctx).UpdateConfig(ctx, applied.BucketConfig); err != nil {
+			slog.Error("Failed to apply bucket limits", "error", err)
+		}
+	}
+	if applied.RetryConfig != current.RetryConfig ||
+		applied.BalancerConfig.HealthCheckInterval != current.BalancerConfig.HealthCheckInterval {
+		a.serviceProvider.Balancer(ctx).UpdateConfig(applied.BalancerConfig, applied.RetryConfig)
+	}
+	if !slices.Equal(applied.BalancerConfig.Backends, current.BalancerConfig.Backends) {
+		a.serviceProvider.Balancer(ctx).SetBackends(applied.BalancerConfig.Backends)
+	}
+}
+
+// initHistory добавляет в историю конфигурацию, загруженную при запуске
+func (a *App) initHistory(_ context.Context) error {
+	a.recordConfig(history.SourceStartup, a.serviceProvider.Config())
+	return nil
+}
+
+// initBackendsWatcher применяет бэкенды при изменении backends_file
+func (a *App) initBackendsWatcher(ctx context.Context) error {
+	if path := a.serviceProvider.Config().BalancerConfig.BackedsFile; path != "" {
+		balancer.CheckAndUpdate(ctx, path, func(backends []config.BackendConfig) {
+			a.reloadBackends(ctx, backends)
+		})
+	}
+	return nil
+}
+
+// initConfigWatcher перезагружает конфигурацию при изменении файла
+func (a *App) initConfigWatcher(ctx context.Context) error {
+	watcher, err := config.NewWatcher(globalConfigPath)
+	if err != nil {
+		return fmt.Errorf("error watching config: %w", err)
+	}
+
+	watcher.DoRun(ctx, func() {
+		result, err := a.ReloadConfig(ctx)
+		if err != nil {
+			slog.Error("Config reload failed, keeping current config", "error", err)
+			return
+		}
+		slog.Info("Config reloaded", "applied", result.Applied)
+		if len(result.RestartRequired) > 0 {
+			slog.Warn("Config changes require restart", "fields", result.RestartRequired)
+		}
+	})
+	return nil
+}
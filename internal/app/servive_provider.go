@@ -3,22 +3,50 @@ package app
 import (
 	"context"
 	"log"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/admin"
 	"github.com/vakhrushevk/cloudru/internal/balancer"
+	"github.com/vakhrushevk/cloudru/internal/clientip"
 	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/history"
+	ipfilter "github.com/vakhrushevk/cloudru/internal/ipFilter"
+	"github.com/vakhrushevk/cloudru/internal/metrics"
 	ratelimit "github.com/vakhrushevk/cloudru/internal/rateLimit"
 	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/failover"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
 	"github.com/vakhrushevk/cloudru/internal/repository/redisRepository"
 	"github.com/vakhrushevk/cloudru/pkg/logger"
 )
 
+// defaultRedisPingInterval период проверки доступности Redis, если он не задан в конфигурации
+const defaultRedisPingInterval = time.Second
+
 type serviceProvider struct {
-	redisClient      *redis.Client
-	limiter          *ratelimit.Limiter
-	balancer         balancer.Balancer
-	bucketRepository repository.BucketRepository
-	config           *config.Config
+	redisClient           redis.UniversalClient
+	limiter               *ratelimit.Limiter
+	balancer              balancer.Balancer
+	bucketRepository      repository.BucketRepository
+	overrideRepository    repository.OverrideRepository
+	windowRepository      repository.WindowRepository
+	concurrencyRepository repository.ConcurrencyRepository
+	quotaRepository       repository.QuotaRepository
+	quotaLimiter          *ratelimit.QuotaLimiter
+	banRepository         repository.BanRepository
+	penaltyBox            *ratelimit.PenaltyBox
+	storeHealth           *failover.Health
+	memoryStore           *memoryRepository.Repository
+	clientIPResolver      *clientip.Resolver
+	ipFilter              *ipfilter.Filter
+	history               *history.History
+	adminServer           *admin.Server
+
+	configMu sync.Mutex
+	config   *config.Config
 }
 
 // NewServiceProvider создает новый сервис-провайдер
@@ -35,6 +63,9 @@ func (s *serviceProvider) InitLogger() {
 
 // Config возвращает конфигурацию или загружает ее
 func (s *serviceProvider) Config() *config.Config {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
 	if s.config == nil {
 		cfg, err := config.LoadConfig(globalConfigPath)
 		if err != nil {
@@ -46,52 +77,349 @@ func (s *serviceProvider) Config() *config.Config {
 	return s.config
 }
 
+// setConfig заменяет действующую конфигурацию
+func (s *serviceProvider) setConfig(cfg *config.Config) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+	s.config = cfg
+}
+
+// ClientIPResolver создает резолвер IP адреса клиента или возвращает существующий
+func (s *serviceProvider) ClientIPResolver() *clientip.Resolver {
+	if s.clientIPResolver == nil {
+		resolver, err := clientip.NewResolver(s.Config().ClientIPConfig)
+		if err != nil {
+			log.Fatal("error creating client ip resolver:", err)
+		}
+		s.clientIPResolver = resolver
+	}
+
+	return s.clientIPResolver
+}
+
+// IPFilter создает фильтр клиентов по IP адресу или возвращает существующий.
+// Возвращает nil, если файл со списками адресов не задан
+func (s *serviceProvider) IPFilter(ctx context.Context) *ipfilter.Filter {
+	if s.ipFilter == nil && s.Config().IPFilterConfig.File != "" {
+		filter, err := ipfilter.Load(ctx, s.Config().IPFilterConfig.File)
+		if err != nil {
+			log.Fatal("error creating ip filter:", err)
+		}
+		s.ipFilter = filter
+	}
+
+	return s.ipFilter
+}
+
+// History создает историю конфигураций или возвращает существующую
+func (s *serviceProvider) History() *history.History {
+	if s.history == nil {
+		h, err := history.New(s.Config().HistoryConfig)
+		if err != nil {
+			log.Fatal("error creating config history:", err)
+		}
+		s.history = h
+	}
+
+	return s.history
+}
+
 // RedisClient создает новый клиент Redis или возвращает существующий
-func (s *serviceProvider) RedisClient(_ context.Context) *redis.Client {
+func (s *serviceProvider) RedisClient(_ context.Context) redis.UniversalClient {
 	if s.redisClient == nil {
-		s.redisClient = redis.NewClient(&redis.Options{
-			Addr:     s.Config().RedisConfig.Addr,
-			Password: s.Config().RedisConfig.Password,
-			DB:       s.Config().RedisConfig.DB,
-		})
-		_, err := s.redisClient.Ping().Result()
+		client, err := redisRepository.NewClient(s.Config().RedisConfig)
 		if err != nil {
-			log.Fatal("error connecting to redis:", err)
+			log.Fatal("error creating redis client:", err)
 		}
+		s.redisClient = client
 	}
 
 	return s.redisClient
 }
 
+// StoreHealth создает монитор доступности Redis или возвращает существующий.
+// Недоступность Redis при старте не является ошибкой: монитор переключит хранилище, когда Redis вернется
+func (s *serviceProvider) StoreHealth(ctx context.Context) *failover.Health {
+	if s.storeHealth == nil {
+		client := s.RedisClient(ctx)
+		s.storeHealth = failover.NewHealth(func() error {
+			return client.Ping().Err()
+		})
+
+		interval := s.Config().RedisConfig.PingInterval
+		if interval <= 0 {
+			interval = defaultRedisPingInterval
+		}
+		s.storeHealth.Start(ctx, interval)
+	}
+
+	return s.storeHealth
+}
+
+// MemoryStore создает хранилище в памяти процесса или возвращает существующее
+func (s *serviceProvider) MemoryStore(ctx context.Context) *memoryRepository.Repository {
+	if s.memoryStore == nil {
+		s.memoryStore = memoryRepository.NewMemoryRepository(ctx, s.Config().RateLimitConfig.Memory)
+	}
+	return s.memoryStore
+}
+
+// useMemoryStorage возвращает true, если лимиты хранятся только в памяти процесса
+func (s *serviceProvider) useMemoryStorage() bool {
+	switch s.Config().RateLimitConfig.Storage {
+	case "", ratelimit.StorageRedis:
+		return false
+	case ratelimit.StorageMemory:
+		return true
+	default:
+		log.Fatal("unknown rate limit storage:", s.Config().RateLimitConfig.Storage)
+		return false
+	}
+}
+
+// fallbackStore возвращает хранилище в памяти, если при недоступности Redis лимиты считаются локально, иначе nil
+func (s *serviceProvider) fallbackStore(ctx context.Context) *memoryRepository.Repository {
+	switch s.Config().RateLimitConfig.OnStoreError {
+	case "", ratelimit.OnStoreErrorDeny, ratelimit.OnStoreErrorAllow:
+		return nil
+	case ratelimit.OnStoreErrorLocal:
+		return s.MemoryStore(ctx)
+	default:
+		log.Fatal("unknown on_store_error policy:", s.Config().RateLimitConfig.OnStoreError)
+		return nil
+	}
+}
+
 // BucketRepository создает новый репозиторий бакетов или возвращает существующий
 func (s *serviceProvider) BucketRepository(ctx context.Context) repository.BucketRepository {
 	if s.bucketRepository == nil {
+		if s.useMemoryStorage() {
+			s.bucketRepository = s.MemoryStore(ctx)
+			return s.bucketRepository
+		}
+
 		bucketRepo, err := redisRepository.NewRedisRepository(s.RedisClient(ctx))
 		if err != nil {
 			log.Fatal("error creating bucket repository:", err)
 		}
-		s.bucketRepository = bucketRepo
+
+		var fallback repository.BucketRepository
+		if store := s.fallbackStore(ctx); store != nil {
+			fallback = store
+		}
+		s.bucketRepository = failover.NewBucketRepository(bucketRepo, fallback, s.StoreHealth(ctx))
 	}
 
 	return s.bucketRepository
 }
 
+// OverrideRepository создает новый репозиторий переопределений лимитов или возвращает существующий
+func (s *serviceProvider) OverrideRepository(ctx context.Context) repository.OverrideRepository {
+	if s.overrideRepository == nil {
+		if s.useMemoryStorage() {
+			s.overrideRepository = s.MemoryStore(ctx)
+			return s.overrideRepository
+		}
+
+		overrideRepo, err := redisRepository.NewOverrideRepository(s.RedisClient(ctx))
+		if err != nil {
+			log.Fatal("error creating override repository:", err)
+		}
+		s.overrideRepository = failover.NewOverrideRepository(overrideRepo, s.StoreHealth(ctx))
+	}
+
+	return s.overrideRepository
+}
+
+// WindowRepository создает новый репозиторий счетчиков фиксированного окна или возвращает существующий
+func (s *serviceProvider) WindowRepository(ctx context.Context) repository.WindowRepository {
+	if s.windowRepository == nil {
+		if s.useMemoryStorage() {
+			s.windowRepository = s.MemoryStore(ctx)
+			return s.windowRepository
+		}
+
+		windowRepo, err := redisRepository.NewWindowRepository(s.RedisClient(ctx))
+		if err != nil {
+			log.Fatal("error creating window repository:", err)
+		}
+
+		var fallback repository.WindowRepository
+		if store := s.fallbackStore(ctx); store != nil {
+			fallback = store
+		}
+		s.windowRepository = failover.NewWindowRepository(windowRepo, fallback, s.StoreHealth(ctx))
+	}
+
+	return s.windowRepository
+}
+
+// ConcurrencyRepository создает новый репозиторий слотов одновременных запросов или возвращает существующий
+func (s *serviceProvider) ConcurrencyRepository(ctx context.Context) repository.ConcurrencyRepository {
+	if s.concurrencyRepository == nil {
+		storage := s.Config().ConcurrencyConfig.Storage
+		if storage == ratelimit.StorageMemory || storage == "" && s.useMemoryStorage() {
+			s.concurrencyRepository = s.MemoryStore(ctx)
+			return s.concurrencyRepository
+		}
+		if storage != "" && storage != ratelimit.StorageRedis {
+			log.Fatal("unknown concurrency storage:", storage)
+		}
+
+		concurrencyRepo, err := redisRepository.NewConcurrencyRepository(s.RedisClient(ctx))
+		if err != nil {
+			log.Fatal("error creating concurrency repository:", err)
+		}
+
+		var fallback repository.ConcurrencyRepository
+		if store := s.fallbackStore(ctx); store != nil {
+			fallback = store
+		}
+		s.concurrencyRepository = failover.NewConcurrencyRepository(concurrencyRepo, fallback, s.StoreHealth(ctx))
+	}
+
+	return s.concurrencyRepository
+}
+
+// QuotaRepository создает новый репозиторий счетчиков квот или возвращает существующий
+func (s *serviceProvider) QuotaRepository(ctx context.Context) repository.QuotaRepository {
+	if s.quotaRepository == nil {
+		if s.useMemoryStorage() {
+			s.quotaRepository = s.MemoryStore(ctx)
+			return s.quotaRepository
+		}
+
+		quotaRepo, err := redisRepository.NewQuotaRepository(s.RedisClient(ctx))
+		if err != nil {
+			log.Fatal("error creating quota repository:", err)
+		}
+
+		var fallback repository.QuotaRepository
+		if store := s.fallbackStore(ctx); store != nil {
+			fallback = store
+		}
+		s.quotaRepository = failover.NewQuotaRepository(quotaRepo, fallback, s.StoreHealth(ctx))
+	}
+
+	return s.quotaRepository
+}
+
+// QuotaLimiter создает ограничитель квот или возвращает существующий.
+// Возвращает nil, если квоты не заданы в конфигурации
+func (s *serviceProvider) QuotaLimiter(ctx context.Context) *ratelimit.QuotaLimiter {
+	cfg := s.Config().RateLimitConfig
+	if s.quotaLimiter == nil && len(cfg.Quota.Limits) > 0 {
+		keyCfg := cfg.Quota.Key
+		if keyCfg.Type == "" {
+			keyCfg = cfg.Key
+		}
+		extractor, err := ratelimit.NewKeyExtractor(keyCfg)
+		if err != nil {
+			log.Fatal("error creating quota key extractor:", err)
+		}
+
+		limiter, err := ratelimit.NewQuotaLimiter(s.QuotaRepository(ctx), extractor, cfg.Quota, cfg.OnStoreError)
+		if err != nil {
+			log.Fatal("error creating quota limiter:", err)
+		}
+		s.quotaLimiter = limiter
+	}
+	return s.quotaLimiter
+}
+
+// BanRepository создает новый репозиторий блокировок или возвращает существующий
+func (s *serviceProvider) BanRepository(ctx context.Context) repository.BanRepository {
+	if s.banRepository == nil {
+		if s.useMemoryStorage() {
+			s.banRepository = s.MemoryStore(ctx)
+			return s.banRepository
+		}
+
+		banRepo, err := redisRepository.NewBanRepository(s.RedisClient(ctx))
+		if err != nil {
+			log.Fatal("error creating ban repository:", err)
+		}
+
+		var fallback repository.BanRepository
+		if store := s.fallbackStore(ctx); store != nil {
+			fallback = store
+		}
+		s.banRepository = failover.NewBanRepository(banRepo, fallback, s.StoreHealth(ctx))
+	}
+
+	return s.banRepository
+}
+
+// PenaltyBox создает блокировщик клиентов или возвращает существующий.
+// Возвращает nil, если блокировки выключены в конфигурации
+func (s *serviceProvider) PenaltyBox(ctx context.Context) *ratelimit.PenaltyBox {
+	cfg := s.Config().RateLimitConfig
+	if s.penaltyBox == nil && cfg.Ban.Threshold > 0 {
+		keyCfg := cfg.Ban.Key
+		if keyCfg.Type == "" {
+			keyCfg = cfg.Key
+		}
+		extractor, err := ratelimit.NewKeyExtractor(keyCfg)
+		if err != nil {
+			log.Fatal("error creating ban key extractor:", err)
+		}
+
+		box, err := ratelimit.NewPenaltyBox(s.BanRepository(ctx), s.WindowRepository(ctx), extractor, cfg.Ban)
+		if err != nil {
+			log.Fatal("error creating penalty box:", err)
+		}
+		box.StartSync(ctx)
+		s.penaltyBox = box
+	}
+	return s.penaltyBox
+}
+
 // Limiter создает новый лимитер или возвращает существующий
 func (s *serviceProvider) Limiter(ctx context.Context) *ratelimit.Limiter {
 	if s.limiter == nil {
-		s.limiter = ratelimit.NewLimiter(ctx, s.BucketRepository(ctx), s.Config().BucketConfig)
+		s.limiter = ratelimit.NewLimiter(ctx, s.BucketRepository(ctx), s.OverrideRepository(ctx), s.Config().BucketConfig)
+		s.limiter.StartSyncOverrides(ctx, s.Config().RateLimitConfig.OverridesSyncInterval)
+		// бакеты, созданные до перезапуска с другими лимитами по умолчанию
+		if err := s.limiter.SyncBucketLimits(ctx); err != nil {
+			slog.Error("Failed to sync bucket limits", "error", err)
+		}
 	}
 	return s.limiter
 }
 
+// AdminServer создает административный сервер или возвращает существующий.
+// Возвращает nil, если административный сервер выключен в конфигурации
+func (s *serviceProvider) AdminServer(ctx context.Context) *admin.Server {
+	if s.adminServer == nil && s.Config().AdminConfig.ListenPort != 0 {
+		server, err := admin.New(s.Config().AdminConfig)
+		if err != nil {
+			log.Fatal("error creating admin server:", err)
+		}
+		server.RegisterOverrides(s.Limiter(ctx))
+		server.RegisterBuckets(s.BucketRepository(ctx))
+		server.RegisterLogLevel()
+		server.RegisterMetrics()
+		if quotas := s.QuotaLimiter(ctx); quotas != nil {
+			server.RegisterQuotas(quotas)
+		}
+		if box := s.PenaltyBox(ctx); box != nil {
+			server.RegisterBans(box)
+		}
+		s.adminServer = server
+	}
+	return s.adminServer
+}
+
 // Balancer создает новый балансер или возвращает существующий
 func (s *serviceProvider) Balancer(ctx context.Context) balancer.Balancer {
 	if s.balancer == nil {
 		balance, err := balancer.New(ctx, s.Config().BalancerConfig, s.Config().RetryConfig)
-		balancer.CheckAndUpdate(*s.Config(), balance)
 		if err != nil {
 			log.Fatal("error creating balancer:", err)
 		}
+		if err := metrics.RegisterBackends(metrics.DefaultPool, balance.Backends); err != nil {
+			log.Fatal("error registering backend metrics:", err)
+		}
 		s.balancer = balance
 	}
 	return s.balancer
@@ -4,25 +4,56 @@ package backend
 import (
 	"errors"
 	"net"
+	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+var (
+	// ErrBackendNotFound ошибка, если бэкенд с таким адресом не зарегистрирован
+	ErrBackendNotFound = errors.New("backend not found")
+	// ErrBackendExists ошибка, если бэкенд с таким адресом уже зарегистрирован
+	ErrBackendExists = errors.New("backend already exists")
+)
+
 // Backend структура backend
 type Backend struct {
 	URL          *url.URL
 	alive        bool
+	draining     bool
+	weight       int
+	lastCheck    time.Time
+	lastError    string
 	rwmu         sync.RWMutex
 	ReverseProxy *httputil.ReverseProxy
+
+	requests atomic.Uint64
+	failures atomic.Uint64
+	active   atomic.Int64
+}
+
+// Status состояние и статистика бэкенда
+type Status struct {
+	URL       string    `json:"url"`
+	Alive     bool      `json:"alive"`
+	Draining  bool      `json:"draining"`   // новые запросы не направляются, начатые завершаются
+	Weight    int       `json:"weight"`     // доля запросов относительно других бэкендов
+	Requests  uint64    `json:"requests"`   // запросов направлено на бэкенд
+	Failures  uint64    `json:"failures"`   // запросов завершилось ошибкой соединения
+	Active    int64     `json:"active"`     // запросов выполняется сейчас
+	LastCheck time.Time `json:"last_check"` // время последней проверки доступности
+	LastError string    `json:"last_error,omitempty"`
 }
 
-// NewBackend создает новый backend
+// NewBackend создает новый backend с весом 1
 func NewBackend(url *url.URL, alive bool, proxy *httputil.ReverseProxy) *Backend {
 	return &Backend{
 		URL:          url,
 		alive:        alive,
+		weight:       1,
 		rwmu:         sync.RWMutex{},
 		ReverseProxy: proxy,
 	}
@@ -39,6 +70,21 @@ func (b *Backend) IsBackendAlive() error {
 	return nil
 }
 
+// Check проверяет доступность backend и запоминает результат
+func (b *Backend) Check() error {
+	err := b.IsBackendAlive()
+
+	b.rwmu.Lock()
+	defer b.rwmu.Unlock()
+	b.alive = err == nil
+	b.lastCheck = time.Now()
+	b.lastError = ""
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	return err
+}
+
 // SetAlive устанавливает доступность backend в alive true/false
 func (b *Backend) SetAlive(alive bool) {
 	b.rwmu.Lock()
@@ -52,3 +98,61 @@ func (b *Backend) IsAlive() bool {
 	defer b.rwmu.RUnlock()
 	return b.alive
 }
+
+// SetDraining включает или выключает вывод backend из балансировки
+func (b *Backend) SetDraining(draining bool) {
+	b.rwmu.Lock()
+	b.draining = draining
+	b.rwmu.Unlock()
+}
+
+// Available проверяет, можно ли направлять на backend новые запросы
+func (b *Backend) Available() bool {
+	b.rwmu.RLock()
+	defer b.rwmu.RUnlock()
+	return b.alive && !b.draining
+}
+
+// Weight возвращает вес backend
+func (b *Backend) Weight() int {
+	b.rwmu.RLock()
+	defer b.rwmu.RUnlock()
+	return b.weight
+}
+
+// SetWeight устанавливает вес backend, вес меньше 1 считается равным 1
+func (b *Backend) SetWeight(weight int) {
+	b.rwmu.Lock()
+	b.weight = max(weight, 1)
+	b.rwmu.Unlock()
+}
+
+// Serve направляет запрос на backend и учитывает его в статистике
+func (b *Backend) Serve(w http.ResponseWriter, r *http.Request) {
+	b.requests.Add(1)
+	b.active.Add(1)
+	defer b.active.Add(-1)
+	b.ReverseProxy.ServeHTTP(w, r)
+}
+
+// AddFailure учитывает запрос, завершившийся ошибкой соединения с backend
+func (b *Backend) AddFailure() {
+	b.failures.Add(1)
+}
+
+// Status возвращает состояние и статистику backend
+func (b *Backend) Status() Status {
+	b.rwmu.RLock()
+	defer b.rwmu.RUnlock()
+	return Status{
+		URL:       b.URL.String(),
+		Alive:     b.alive,
+		Draining:  b.draining,
+		Weight:    b.weight,
+		Requests:  b.requests.Load(),
+		Failures:  b.failures.Load(),
+		Active:    b.active.Load(),
+		LastCheck: b.lastCheck,
+		LastError: b.lastError,
+	}
+}
@@ -4,8 +4,10 @@ package balancer
 import (
 	"context"
 	"errors"
+	"log/slog"
 	"net/http"
 
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
 	roundrobin "github.com/vakhrushevk/cloudru/internal/balancer/roundRobin"
 	"github.com/vakhrushevk/cloudru/internal/config"
 )
@@ -18,8 +20,20 @@ var (
 // Balancer интерфейс балансировщика
 type Balancer interface {
 	BalanceHandler() http.Handler
-	RemoveAllBackend()
-	RegisterBackend(URL string)
+	// SetBackends заменяет бэкенды, бэкенды с прежними адресами сохраняют состояние и статистику
+	SetBackends(backends []config.BackendConfig)
+	// AddBackend регистрирует бэкенд, возвращает backend.ErrBackendExists, если адрес уже зарегистрирован
+	AddBackend(cfg config.BackendConfig) error
+	// RemoveBackend удаляет бэкенд, возвращает backend.ErrBackendNotFound, если адрес не зарегистрирован
+	RemoveBackend(URL string) error
+	// Drain выводит бэкенд из балансировки без удаления или возвращает его
+	Drain(URL string, drain bool) error
+	// Backends возвращает состояние и статистику бэкендов
+	Backends() []backend.Status
+	// HealthCheck проверяет доступность бэкендов, не дожидаясь периодической проверки
+	HealthCheck()
+	// UpdateConfig применяет настройки, изменяемые без перезапуска: период проверки бэкендов и повторные попытки
+	UpdateConfig(cfg config.BalancerConfig, retryConfig config.RetryConfig)
 }
 
 // New создает новый балансировщик
@@ -34,17 +48,19 @@ func New(ctx context.Context, cfg config.BalancerConfig, retryConfig config.Retr
 	}
 }
 
-// CheckAndUpdate проверяет и обновляет бэкенды
-func CheckAndUpdate(cfg config.Config, balancer Balancer) {
-	Watcher, err := config.NewWatcher(cfg.BalancerConfig.BackedsFile)
-	Watcher.DoRun(func() {
-		cfg.BalancerConfig.Backends, err = config.LoadBackends(cfg.BalancerConfig.BackedsFile)
+// CheckAndUpdate перечитывает бэкенды при изменении файла path и передает их в update, пока не отменен ctx
+func CheckAndUpdate(ctx context.Context, path string, update func(backends []config.BackendConfig)) {
+	Watcher, err := config.NewWatcher(path)
+	if err != nil {
+		slog.Error("Failed to watch backends file", "file", path, "error", err)
+		return
+	}
+	Watcher.DoRun(ctx, func() {
+		backends, err := config.LoadBackends(path)
 		if err != nil {
+			slog.Error("Failed to reload backends, keeping current backends", "error", err)
 			return
 		}
-		balancer.RemoveAllBackend()
-		for _, b := range cfg.BalancerConfig.Backends {
-			balancer.RegisterBackend(b.URL)
-		}
+		update(backends)
 	})
 }
@@ -7,76 +7,225 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
 	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/metrics"
 	"github.com/vakhrushevk/cloudru/internal/retry"
 )
 
-// Balancer балансировщик на основе round robin
+// responseRecorder запоминает код ответа и бэкенд, который обработал запрос, для метрик
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	backend string
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Balancer балансировщик на основе плавного взвешенного round robin:
+// каждый бэкенд получает долю запросов, пропорциональную весу, без серий запросов подряд на один бэкенд
 type Balancer struct {
-	backends    []*backend.Backend
-	current     uint64
-	mu          sync.RWMutex
-	retryConfig config.RetryConfig
+	pool atomic.Pointer[pool] // неизменяемый набор бэкендов, заменяется целиком при изменении
+	mu   sync.Mutex           // упорядочивает изменения набора бэкендов
+
+	configMu            sync.Mutex
+	retryConfig         config.RetryConfig
+	healthCheckInterval time.Duration
+	healthTicker        *time.Ticker
+}
+
+// pool набор бэкендов с расписанием выбора. Запросы читают его без блокировок
+type pool struct {
+	backends []*backend.Backend
+	schedule []*backend.Backend // порядок выбора бэкендов за один цикл плавного взвешенного round robin
+	next     atomic.Uint64      // номер следующего запроса в расписании
+}
+
+// newPool создает набор бэкендов и строит расписание по их текущим весам.
+// Веса сокращаются на общий делитель, поэтому длина расписания не больше суммы весов
+func newPool(backends []*backend.Backend) *pool {
+	p := &pool{backends: backends}
+	weights := make([]int, len(backends))
+	divisor, total := 0, 0
+	for i, b := range backends {
+		weights[i] = b.Weight()
+		divisor = gcd(divisor, weights[i])
+	}
+	for i := range weights {
+		weights[i] /= divisor
+		total += weights[i]
+	}
+
+	current := make([]int, len(backends))
+	p.schedule = make([]*backend.Backend, 0, total)
+	for range total {
+		best := -1
+		for i, weight := range weights {
+			current[i] += weight
+			if best < 0 || current[i] > current[best] {
+				best = i
+			}
+		}
+		current[best] -= total
+		p.schedule = append(p.schedule, backends[best])
+	}
+	return p
+}
+
+// gcd возвращает наибольший общий делитель
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// backends возвращает текущий набор бэкендов, его нельзя изменять
+func (rb *Balancer) backends() []*backend.Backend {
+	return rb.pool.Load().backends
 }
 
 // New создает новый Balancer
 func New(ctx context.Context, balanceCofnig config.BalancerConfig, retryConfig config.RetryConfig) (*Balancer, error) {
 	rb := &Balancer{}
 	rb.retryConfig = retryConfig
-	rb.backends = make([]*backend.Backend, 0, len(balanceCofnig.Backends))
+	rb.pool.Store(newPool(nil))
 
 	for _, b := range balanceCofnig.Backends {
-		rb.RegisterBackend(b.URL)
+		if err := rb.AddBackend(b); err != nil {
+			slog.Error("Failed to register backend", "backend", b.URL, "error", err)
+		}
 	}
 
-	rb.current = 0
-	rb.mu = sync.RWMutex{}
-
-	go rb.healthCheck(ctx, balanceCofnig.HealthCheckInterval)
+	rb.healthCheckInterval = balanceCofnig.HealthCheckInterval
+	rb.healthTicker = time.NewTicker(rb.healthCheckInterval)
+	go rb.healthCheck(ctx)
 
 	return rb, nil
 }
 
-// RegisterBackend регистрирует новый бэкенд
-func (rb *Balancer) RegisterBackend(URL string) {
-	u, err := url.Parse(URL)
+// newBackend создает бэкенд, ошибки соединения с которым обрабатывает балансировщик
+func (rb *Balancer) newBackend(cfg config.BackendConfig) (*backend.Backend, error) {
+	u, err := url.Parse(cfg.URL)
 	if err != nil {
-		slog.Error("Failed to parse backend URL", "error", err)
-		return
+		return nil, err
 	}
 	proxy := httputil.NewSingleHostReverseProxy(u)
-	backend := backend.NewBackend(u, true, proxy)
+	b := backend.NewBackend(u, true, proxy)
+	b.SetWeight(cfg.Weight)
 	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
-		rb.BalancerErrorHandler(w, r, err, backend)
+		rb.BalancerErrorHandler(w, r, err, b)
 	}
-	rb.backends = append(rb.backends, backend)
+	return b, nil
 }
 
-// nextIndex возвращает следующий индекс в списке backends
-func (rb *Balancer) nextIndex() int {
+// find возвращает индекс бэкенда с адресом URL в backends или -1
+func find(backends []*backend.Backend, URL string) int {
+	URL = config.NormalizeBackendURL(URL)
+	return slices.IndexFunc(backends, func(b *backend.Backend) bool {
+		return config.NormalizeBackendURL(b.URL.String()) == URL
+	})
+}
+
+// AddBackend регистрирует новый бэкенд
+func (rb *Balancer) AddBackend(cfg config.BackendConfig) error {
+	b, err := rb.newBackend(cfg)
+	if err != nil {
+		return err
+	}
+
 	rb.mu.Lock()
 	defer rb.mu.Unlock()
-	if len(rb.backends) == 0 {
-		return -1
+	backends := rb.backends()
+	if find(backends, cfg.URL) >= 0 {
+		return backend.ErrBackendExists
 	}
-	return int(atomic.AddUint64(&rb.current, uint64(1)) % uint64(len(rb.backends)))
+	rb.pool.Store(newPool(append(slices.Clip(backends), b)))
+	return nil
+}
+
+// RemoveBackend удаляет бэкенд, начатые запросы к нему завершаются
+func (rb *Balancer) RemoveBackend(URL string) error {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	backends := rb.backends()
+	i := find(backends, URL)
+	if i < 0 {
+		return backend.ErrBackendNotFound
+	}
+	rb.pool.Store(newPool(slices.Delete(slices.Clone(backends), i, i+1)))
+	return nil
 }
 
-// NextPeer возвращает следующий доступный backend
+// SetBackends заменяет бэкенды. Бэкенды с прежними адресами сохраняют состояние и статистику
+func (rb *Balancer) SetBackends(backends []config.BackendConfig) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	current := rb.backends()
+	next := make([]*backend.Backend, 0, len(backends))
+	for _, cfg := range backends {
+		if i := find(current, cfg.URL); i >= 0 {
+			current[i].SetWeight(cfg.Weight)
+			next = append(next, current[i])
+			continue
+		}
+		b, err := rb.newBackend(cfg)
+		if err != nil {
+			slog.Error("Failed to register backend", "backend", cfg.URL, "error", err)
+			continue
+		}
+		next = append(next, b)
+	}
+	rb.pool.Store(newPool(next))
+}
+
+// Drain выводит бэкенд из балансировки или возвращает его: при drain новые запросы на него не направляются
+func (rb *Balancer) Drain(URL string, drain bool) error {
+	backends := rb.backends()
+	i := find(backends, URL)
+	if i < 0 {
+		return backend.ErrBackendNotFound
+	}
+	backends[i].SetDraining(drain)
+	return nil
+}
+
+// Backends возвращает состояние и статистику бэкендов
+func (rb *Balancer) Backends() []backend.Status {
+	backends := rb.backends()
+	statuses := make([]backend.Status, 0, len(backends))
+	for _, b := range backends {
+		statuses = append(statuses, b.Status())
+	}
+	return statuses
+}
+
+// nextPeer возвращает следующий доступный backend по расписанию плавного взвешенного round robin.
+// Недоступные бэкенды пропускаются, их очередь переходит к следующим по расписанию
 func (rb *Balancer) nextPeer() *backend.Backend {
-	next := rb.nextIndex()
-	for i := next; i < len(rb.backends)+next; i++ {
-		idx := i % len(rb.backends)
-		if rb.backends[idx].IsAlive() {
-			if i != next {
-				atomic.StoreUint64(&rb.current, uint64(idx))
-			}
-			return rb.backends[idx]
+	p := rb.pool.Load()
+	n := uint64(len(p.schedule))
+	if n == 0 {
+		return nil
+	}
+	start := p.next.Add(1) - 1
+	for i := range n {
+		if b := p.schedule[(start+i)%n]; b.Available() {
+			return b
 		}
 	}
 	return nil
@@ -85,16 +234,21 @@ func (rb *Balancer) nextPeer() *backend.Backend {
 // BalanceHandler обрабатывает запросы и перенаправляет их на следующий доступный backend
 func (rb *Balancer) BalanceHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		rb.mu.RLock()
-		if len(rb.backends) == 0 {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			metrics.ObserveRequest(metrics.DefaultPool, rec.backend, rec.status, time.Since(start))
+		}()
+		w = rec
+
+		if len(rb.backends()) == 0 {
 			http.Error(w, "No backends available", http.StatusServiceUnavailable)
 			return
 		}
-		rb.mu.RUnlock()
 
 		peer := rb.nextPeer()
 		if peer != nil {
-			peer.ReverseProxy.ServeHTTP(w, r)
+			serve(peer, w, r)
 			return
 		}
 		slog.Warn("All backends are unavailable")
@@ -105,11 +259,18 @@ func (rb *Balancer) BalanceHandler() http.Handler {
 // BalancerErrorHandler обрабатывает ошибки при перенаправлении запросов на backend
 func (rb *Balancer) BalancerErrorHandler(w http.ResponseWriter, r *http.Request, err error, backend *backend.Backend) {
 	slog.Error("Error redirecting request to backend", "backend", backend.URL.String(), "error", err)
+	backend.AddFailure()
 	backend.SetAlive(false)
+	metrics.BackendFailure(metrics.DefaultPool, backend.URL.String())
 
 	go func() {
 		slog.Info("Attempting to restore connection to backend", "backend", backend.URL.String())
-		retryErr := retry.WithRetry(rb.retryConfig, backend.IsBackendAlive)
+		rb.configMu.Lock()
+		retryConfig := rb.retryConfig
+		rb.configMu.Unlock()
+
+		retryErr := retry.WithRetry(retryConfig, backend.IsBackendAlive)
+		metrics.BackendRetry(metrics.DefaultPool, backend.URL.String(), retryErr == nil)
 		if retryErr == nil {
 			slog.Info("Connection to backend restored", "backend", backend.URL.String())
 			backend.SetAlive(true)
@@ -122,40 +283,68 @@ func (rb *Balancer) BalancerErrorHandler(w http.ResponseWriter, r *http.Request,
 	alt := rb.nextPeer()
 	if alt != nil && alt != backend {
 		slog.Info("Switched to another backend", "backend", alt.URL.String())
-		alt.ReverseProxy.ServeHTTP(w, r)
+		metrics.Failover(metrics.DefaultPool, true)
+		serve(alt, w, r)
 		return
 	}
+	metrics.Failover(metrics.DefaultPool, false)
 	slog.Warn("No other backends available")
 	http.Error(w, "No other backends available", http.StatusServiceUnavailable)
 }
 
-// healthCheck проверяет состояние бэкендов
-func (rb *Balancer) healthCheck(ctx context.Context, delay time.Duration) {
-	t := time.NewTicker(delay)
+// serve направляет запрос на backend и запоминает его для метрик запроса.
+// При переключении на другой бэкенд запоминается тот, который сформировал ответ
+func serve(b *backend.Backend, w http.ResponseWriter, r *http.Request) {
+	if rec, ok := w.(*responseRecorder); ok {
+		rec.backend = b.URL.String()
+	}
+	b.Serve(w, r)
+}
+
+// UpdateConfig применяет новый период проверки бэкендов и настройки повторных попыток
+func (rb *Balancer) UpdateConfig(cfg config.BalancerConfig, retryConfig config.RetryConfig) {
+	rb.configMu.Lock()
+	defer rb.configMu.Unlock()
+
+	rb.retryConfig = retryConfig
+	if cfg.HealthCheckInterval > 0 && cfg.HealthCheckInterval != rb.healthCheckInterval {
+		rb.healthCheckInterval = cfg.HealthCheckInterval
+		rb.healthTicker.Reset(cfg.HealthCheckInterval)
+	}
+}
+
+// HealthCheck проверяет доступность всех бэкендов одновременно и дожидается результата
+func (rb *Balancer) HealthCheck() {
+	backends := rb.backends()
+
+	var wg sync.WaitGroup
+	for _, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			err := b.Check()
+			metrics.ObserveHealthCheck(metrics.DefaultPool, b.URL.String(), err, time.Since(start))
+			if err != nil {
+				slog.Error("Backend is unavailable", "backend", b.URL, "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// healthCheck периодически проверяет состояние бэкендов
+func (rb *Balancer) healthCheck(ctx context.Context) {
+	t := rb.healthTicker
+	defer t.Stop()
 	for {
 		select {
 		case <-t.C:
 			slog.Debug("Starting health check...")
-			for _, backend := range rb.backends {
-				err := backend.IsBackendAlive()
-				if err != nil {
-					slog.Error("Backend is unavailable", "backend", backend.URL, "error", err)
-					backend.SetAlive(false)
-				} else {
-					backend.SetAlive(true)
-				}
-			}
+			rb.HealthCheck()
 			slog.Debug("Health check completed")
 		case <-ctx.Done():
 			return
 		}
 	}
 }
-
-// RemoveAllBackend удаляет все бэкенды
-func (rb *Balancer) RemoveAllBackend() {
-	rb.mu.Lock()
-	defer rb.mu.Unlock()
-	rb.backends = make([]*backend.Backend, 0)
-	atomic.StoreUint64(&rb.current, 0)
-}
@@ -0,0 +1,78 @@
+package roundrobin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+func newTestBalancer(t *testing.T, backends ...config.BackendConfig) *Balancer {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	rb, err := New(ctx, config.BalancerConfig{Backends: backends, HealthCheckInterval: time.Hour}, config.RetryConfig{})
+	require.NoError(t, err)
+	return rb
+}
+
+func peers(rb *Balancer, n int) []string {
+	urls := make([]string, 0, n)
+	for range n {
+		urls = append(urls, rb.nextPeer().URL.Host)
+	}
+	return urls
+}
+
+func TestNextPeerWeighted(t *testing.T) {
+	rb := newTestBalancer(t,
+		config.BackendConfig{URL: "http://a"},
+		config.BackendConfig{URL: "http://b"},
+	)
+	assert.Equal(t, []string{"a", "b", "a", "b"}, peers(rb, 4))
+
+	rb.SetBackends([]config.BackendConfig{
+		{URL: "http://a", Weight: 3},
+		{URL: "http://b"},
+	})
+	assert.Equal(t, []string{"a", "a", "b", "a"}, peers(rb, 4))
+}
+
+func TestManageBackends(t *testing.T) {
+	rb := newTestBalancer(t, config.BackendConfig{URL: "http://a"})
+
+	require.NoError(t, rb.AddBackend(config.BackendConfig{URL: "http://b", Weight: 2}))
+	assert.ErrorIs(t, rb.AddBackend(config.BackendConfig{URL: "http://b"}), backend.ErrBackendExists)
+
+	require.NoError(t, rb.Drain("http://a", true))
+	assert.Equal(t, []string{"b", "b"}, peers(rb, 2))
+
+	// состояние бэкенда сохраняется при замене списка
+	rb.SetBackends([]config.BackendConfig{{URL: "http://a"}, {URL: "http://c"}})
+	statuses := rb.Backends()
+	require.Len(t, statuses, 2)
+	assert.True(t, statuses[0].Draining)
+	assert.Equal(t, "http://c", statuses[1].URL)
+
+	require.NoError(t, rb.RemoveBackend("http://a"))
+	assert.ErrorIs(t, rb.RemoveBackend("http://a"), backend.ErrBackendNotFound)
+	assert.ErrorIs(t, rb.Drain("http://a", false), backend.ErrBackendNotFound)
+	assert.Equal(t, []string{"c"}, peers(rb, 1))
+}
+
+func TestBackendURLNormalized(t *testing.T) {
+	rb := newTestBalancer(t, config.BackendConfig{URL: "http://backend:8000"})
+	require.NoError(t, rb.Drain("HTTP://Backend:8000/", true))
+	assert.ErrorIs(t, rb.AddBackend(config.BackendConfig{URL: "http://backend:8000/"}), backend.ErrBackendExists)
+
+	// бэкенд с тем же адресом в другой записи сохраняет состояние
+	rb.SetBackends([]config.BackendConfig{{URL: "http://BACKEND:8000/", Weight: 2}})
+	statuses := rb.Backends()
+	require.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Draining)
+	assert.Equal(t, "http://backend:8000", statuses[0].URL)
+}
@@ -0,0 +1,192 @@
+// Package clientip определяет IP адрес клиента с учетом доверенных прокси
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+const (
+	headerForwarded     = "Forwarded"
+	headerXForwardedFor = "X-Forwarded-For"
+	headerXRealIP       = "X-Real-IP"
+)
+
+type contextKey struct{}
+
+// Resolver определяет IP адрес клиента. Если запрос пришел от доверенного прокси,
+// IP берется из заданного заголовка прокси: крайний правый адрес, не принадлежащий доверенным прокси.
+// Остальные заголовки прокси клиент может подделать, поэтому они не учитываются.
+type Resolver struct {
+	trusted []*net.IPNet
+	header  string
+}
+
+// NewResolver создает новый Resolver
+func NewResolver(cfg config.ClientIPConfig) (*Resolver, error) {
+	r := &Resolver{header: http.CanonicalHeaderKey(cfg.Header)}
+	switch r.header {
+	case headerForwarded, headerXForwardedFor, http.CanonicalHeaderKey(headerXRealIP):
+	case "":
+		if len(cfg.TrustedProxies) > 0 {
+			return nil, fmt.Errorf("header is required with trusted proxies")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported client IP header %q", cfg.Header)
+	}
+
+	for _, p := range cfg.TrustedProxies {
+		network, err := parseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		r.trusted = append(r.trusted, network)
+	}
+
+	return r, nil
+}
+
+// parseCIDR разбирает CIDR или одиночный IP адрес
+func parseCIDR(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, network, err := net.ParseCIDR(s)
+		return network, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address")
+	}
+	bits := 8 * net.IPv4len
+	if ip.To4() == nil {
+		bits = 8 * net.IPv6len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// isTrusted проверяет, принадлежит ли ip доверенным прокси
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	for _, network := range r.trusted {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP возвращает IP адрес клиента
+func (r *Resolver) ClientIP(req *http.Request) string {
+	peer := remoteHost(req.RemoteAddr)
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil || !r.isTrusted(peerIP) || r.header == "" {
+		return peer
+	}
+
+	chain := r.chain(req.Header, r.header)
+	// идем справа налево, пропуская доверенные прокси
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !r.isTrusted(chain[i]) || i == 0 {
+			return chain[i].String()
+		}
+	}
+
+	return peer
+}
+
+// chain возвращает цепочку адресов из заголовка header
+func (r *Resolver) chain(h http.Header, header string) []net.IP {
+	var values []string
+	switch header {
+	case headerForwarded:
+		values = parseForwarded(h.Values(header))
+	default:
+		for _, v := range h.Values(header) {
+			values = append(values, strings.Split(v, ",")...)
+		}
+	}
+
+	chain := make([]net.IP, 0, len(values))
+	for _, v := range values {
+		ip := net.ParseIP(stripPort(strings.TrimSpace(v)))
+		if ip == nil {
+			// цепочке с нераспознанным адресом нельзя доверять дальше этого места
+			chain = chain[:0]
+			continue
+		}
+		chain = append(chain, ip)
+	}
+	return chain
+}
+
+// parseForwarded извлекает значения for= из заголовков Forwarded (RFC 7239)
+func parseForwarded(values []string) []string {
+	var result []string
+	for _, v := range values {
+		for _, element := range strings.Split(v, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					result = append(result, strings.Trim(value, `"`))
+				}
+			}
+		}
+	}
+	return result
+}
+
+// stripPort убирает порт и квадратные скобки из адреса
+func stripPort(s string) string {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		return host
+	}
+	return strings.Trim(s, "[]")
+}
+
+// remoteHost возвращает хост из RemoteAddr
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return host
+}
+
+// Middleware определяет IP клиента и сохраняет его в контексте запроса.
+// Заголовки прокси от недоверенных клиентов удаляются, чтобы их нельзя было подделать,
+// а в X-Real-IP для бэкендов выставляется определенный IP клиента.
+func (r *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := r.ClientIP(req)
+
+		if peer := net.ParseIP(remoteHost(req.RemoteAddr)); peer == nil || !r.isTrusted(peer) {
+			req.Header.Del(headerForwarded)
+			req.Header.Del(headerXForwardedFor)
+		}
+		req.Header.Set(headerXRealIP, ip)
+
+		next.ServeHTTP(w, req.WithContext(NewContext(req.Context(), ip)))
+	})
+}
+
+// NewContext возвращает контекст с IP клиента
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, contextKey{}, ip)
+}
+
+// FromContext возвращает IP клиента из контекста
+func FromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(contextKey{}).(string)
+	return ip, ok && ip != ""
+}
+
+// FromRequest возвращает IP клиента, определенный Middleware, или хост из RemoteAddr
+func FromRequest(r *http.Request) string {
+	if ip, ok := FromContext(r.Context()); ok {
+		return ip
+	}
+	return remoteHost(r.RemoteAddr)
+}
@@ -0,0 +1,124 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+func TestResolverClientIP(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", "2001:db8::1"}
+
+	tests := []struct {
+		name       string
+		header     string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{
+			name:       "untrusted peer ignores headers",
+			remoteAddr: "203.0.113.7:5000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1"},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "trusted peer without headers",
+			remoteAddr: "10.0.0.2:5000",
+			want:       "10.0.0.2",
+		},
+		{
+			name:       "right-most untrusted hop",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.1, 10.0.0.3"},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "forwarded",
+			header:     "Forwarded",
+			remoteAddr: "10.0.0.2:5000",
+			headers: map[string]string{
+				"Forwarded":       `for=198.51.100.2;proto=https, for="[2001:db8::1]:4711"`,
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "198.51.100.2",
+		},
+		{
+			name:       "client forwarded is not trusted",
+			remoteAddr: "10.0.0.2:5000",
+			headers: map[string]string{
+				"Forwarded":       "for=6.6.6.6",
+				"X-Forwarded-For": "198.51.100.1",
+			},
+			want: "198.51.100.1",
+		},
+		{
+			name:       "x-real-ip",
+			header:     "x-real-ip",
+			remoteAddr: "[2001:db8::1]:443",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.3"},
+			want:       "198.51.100.3",
+		},
+		{
+			name:       "all hops trusted",
+			remoteAddr: "10.0.0.2:5000",
+			headers:    map[string]string{"X-Forwarded-For": "10.1.1.1, 10.0.0.3"},
+			want:       "10.1.1.1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header
+			if header == "" {
+				header = "X-Forwarded-For"
+			}
+			resolver, err := NewResolver(config.ClientIPConfig{TrustedProxies: trusted, Header: header})
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+
+			assert.Equal(t, tt.want, resolver.ClientIP(req))
+		})
+	}
+}
+
+func TestMiddlewareStripsSpoofedHeaders(t *testing.T) {
+	resolver, err := NewResolver(config.ClientIPConfig{})
+	require.NoError(t, err)
+
+	var got *http.Request
+	handler := resolver.Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:5000"
+	req.Header.Set("X-Forwarded-For", "1.1.1.1")
+	req.Header.Set("X-Real-IP", "1.1.1.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NotNil(t, got)
+	assert.Empty(t, got.Header.Get("X-Forwarded-For"))
+	assert.Equal(t, "203.0.113.7", got.Header.Get("X-Real-IP"))
+	assert.Equal(t, "203.0.113.7", FromRequest(got))
+}
+
+func TestNewResolverInvalid(t *testing.T) {
+	_, err := NewResolver(config.ClientIPConfig{TrustedProxies: []string{"not-an-ip"}, Header: "X-Forwarded-For"})
+	assert.Error(t, err)
+
+	_, err = NewResolver(config.ClientIPConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+	assert.Error(t, err)
+
+	_, err = NewResolver(config.ClientIPConfig{Header: "X-Client-IP"})
+	assert.Error(t, err)
+}
@@ -11,19 +11,56 @@ import (
 
 // Config конфигурация приложения
 type Config struct {
-	HTTPConfig     HTTPConfig     `yaml:"http"`
-	RetryConfig    RetryConfig    `yaml:"retry"`
-	BalancerConfig BalancerConfig `yaml:"balancer"`
-	LoggerConfig   LoggerConfig   `yaml:"logger"`
-	BucketConfig   BucketConfig   `yaml:"bucket"`
-	RedisConfig    RedisConfig    `yaml:"redis"`
+	HTTPConfig        HTTPConfig        `yaml:"http"`
+	AdminConfig       AdminConfig       `yaml:"admin"`
+	ClientIPConfig    ClientIPConfig    `yaml:"client_ip"`
+	IPFilterConfig    IPFilterConfig    `yaml:"ip_filter"`
+	RetryConfig       RetryConfig       `yaml:"retry"`
+	BalancerConfig    BalancerConfig    `yaml:"balancer"`
+	LoggerConfig      LoggerConfig      `yaml:"logger"`
+	BucketConfig      BucketConfig      `yaml:"bucket"`
+	ConcurrencyConfig ConcurrencyConfig `yaml:"concurrency"`
+	RateLimitConfig   RateLimitConfig   `yaml:"rate_limit"`
+	RedisConfig       RedisConfig       `yaml:"redis"`
+	HistoryConfig     HistoryConfig     `yaml:"history"`
 }
 
 // HTTPConfig конфигурация HTTP сервера
 type HTTPConfig struct {
 	ListenPort   int `yaml:"listen_port"`
-	ReadTimeout  int `yaml:"read_timeout"`
-	WriteTimeout int `yaml:"write_timeout"`
+	ReadTimeout  int `yaml:"read_timeout"`  // время чтения запроса в секундах, 0 - без ограничения
+	WriteTimeout int `yaml:"write_timeout"` // время записи ответа в секундах, 0 - без ограничения
+}
+
+// AdminConfig конфигурация административного HTTP сервера
+type AdminConfig struct {
+	ListenAddr string `yaml:"listen_addr"`         // адрес интерфейса административного сервера, по умолчанию 127.0.0.1
+	ListenPort int    `yaml:"listen_port"`         // порт административного сервера, 0 - сервер выключен
+	Token      string `yaml:"token" secret:"true"` // токен доступа, передается в заголовке Authorization: Bearer
+}
+
+// ClientIPConfig конфигурация определения IP адреса клиента
+type ClientIPConfig struct {
+	TrustedProxies []string `yaml:"trusted_proxies"` // CIDR или IP доверенных прокси
+	Header         string   `yaml:"header"`          // заголовок с IP клиента, который перезаписывают доверенные прокси: Forwarded, X-Forwarded-For или X-Real-IP
+}
+
+// HistoryConfig конфигурация истории примененных конфигураций
+type HistoryConfig struct {
+	Size int    `yaml:"size"` // количество хранимых версий, 0 - история не ведется
+	File string `yaml:"file"` // файл журнала версий в формате JSON lines, пустой - история только в памяти
+}
+
+// IPFilterConfig конфигурация фильтрации клиентов по IP адресу
+type IPFilterConfig struct {
+	File string `yaml:"file"` // путь к файлу со списками адресов, пусто - фильтрация выключена
+}
+
+// IPListsConfig списки CIDR или IP адресов клиентов
+type IPListsConfig struct {
+	Allow  []string `yaml:"allow"`  // разрешенные адреса, имеют приоритет над более широкими запрещенными
+	Deny   []string `yaml:"deny"`   // запрещенные адреса
+	Exempt []string `yaml:"exempt"` // адреса, на которые не распространяются ограничения запросов
 }
 
 // RetryConfig конфигурация повторных попыток
@@ -37,13 +74,14 @@ type RetryConfig struct {
 type BalancerConfig struct {
 	Strategy            string          `yaml:"strategy"`
 	BackedsFile         string          `yaml:"backends_file"`
-	Backends            []BackendConfig `yaml:"-"`
+	Backends            []BackendConfig `yaml:"backends"` // бэкенды в основной конфигурации, если не задан backends_file
 	HealthCheckInterval time.Duration   `yaml:"health_check_interval"`
 }
 
 // BackendConfig конфигурация бэкенда
 type BackendConfig struct {
-	URL string `yaml:"url"`
+	URL    string `yaml:"url"`
+	Weight int    `yaml:"weight"` // доля запросов относительно других бэкендов, 0 - 1
 }
 
 // LoggerConfig конфигурация логгера
@@ -82,46 +120,255 @@ type BucketConfig struct {
 	Capacity  int           `yaml:"capacity"`   // default Максимальное количество токенов в бакете
 	RefilRate int           `yaml:"refil_rate"` // default Дефолтное время заполнения токенов для бакета
 	RefilTime time.Duration `yaml:"refil_time"` // Время через которое будет запущено заполнение токенов для бакета
-	Tokens    int           `yaml:"tokens"`     // default Количество токенов в бакете
+	Tokens    *int          `yaml:"tokens"`     // default Количество токенов в новом бакете, не задано - равно capacity
+}
+
+// InitialTokens возвращает количество токенов в новом бакете
+func (b BucketConfig) InitialTokens() int {
+	if b.Tokens == nil {
+		return b.Capacity
+	}
+	return *b.Tokens
+}
+
+// ConcurrencyConfig конфигурация ограничения одновременных запросов клиента
+type ConcurrencyConfig struct {
+	MaxInFlight int                `yaml:"max_in_flight"` // максимальное количество одновременных запросов клиента, 0 - без ограничения
+	LeaseTTL    time.Duration      `yaml:"lease_ttl"`     // время, через которое слот упавшего экземпляра освобождается, по умолчанию 30s
+	Key         KeyExtractorConfig `yaml:"key"`           // способ определения клиента, по умолчанию как rate_limit.key
+	Storage     string             `yaml:"storage"`       // redis, memory (только в этом экземпляре), по умолчанию как rate_limit.storage
+}
+
+// RateLimitConfig конфигурация rate limiter
+type RateLimitConfig struct {
+	Headers      bool               `yaml:"headers"`       // добавлять заголовки RateLimit-* к разрешенным ответам
+	ShadowHeader bool               `yaml:"shadow_header"` // добавлять заголовок X-RateLimit-Shadow с политиками в режиме shadow, которые отклонили бы запрос
+	Key          KeyExtractorConfig `yaml:"key"`           // способ определения клиента, по умолчанию IP адрес
+
+	OverridesSyncInterval time.Duration `yaml:"overrides_sync_interval"` // период загрузки переопределений лимитов из Redis
+
+	Policies []PolicyConfig `yaml:"policies"` // политики для отдельных маршрутов, применяются вместе с лимитом по умолчанию
+
+	OnStoreError string `yaml:"on_store_error"` // поведение при недоступности Redis: allow, deny (по умолчанию), local
+
+	Storage string            `yaml:"storage"` // хранилище лимитов: redis (по умолчанию), memory
+	Memory  MemoryStoreConfig `yaml:"memory"`  // настройки хранилища в памяти, используется и как резервное для local
+
+	Hybrid HybridConfig `yaml:"hybrid"` // локальный расход токенов, арендованных у хранилища партиями
+
+	Quota QuotaConfig `yaml:"quota"` // квоты за сутки и месяц
+
+	Cost CostConfig `yaml:"cost"` // стоимость запросов в токенах
+
+	Ban BanConfig `yaml:"ban"` // временная блокировка клиентов, которые слишком часто превышают лимит
+}
+
+// BanConfig конфигурация временной блокировки клиентов
+type BanConfig struct {
+	Threshold    int                `yaml:"threshold"`     // количество отказов за window, после которого клиент блокируется, 0 - выключено
+	Window       time.Duration      `yaml:"window"`        // окно подсчета отказов
+	Duration     time.Duration      `yaml:"duration"`      // длительность первой блокировки, каждая следующая подряд вдвое дольше
+	MaxDuration  time.Duration      `yaml:"max_duration"`  // максимальная длительность блокировки
+	Reset        time.Duration      `yaml:"reset"`         // через сколько после окончания блокировки длительность возвращается к duration
+	SyncInterval time.Duration      `yaml:"sync_interval"` // период загрузки блокировок других экземпляров из хранилища
+	Key          KeyExtractorConfig `yaml:"key"`           // способ определения клиента, по умолчанию rate_limit.key
+}
+
+// CostConfig стоимость запросов в единицах лимита, по умолчанию запрос стоит 1
+type CostConfig struct {
+	Header string           `yaml:"header"` // заголовок ответа бэкенда с полной стоимостью запроса, разница списывается после ответа
+	Rules  []CostRuleConfig `yaml:"rules"`  // правила по маршрутам, применяется первое совпавшее
+}
+
+// CostRuleConfig стоимость запросов, совпавших с match
+type CostRuleConfig struct {
+	Match MatchConfig `yaml:"match"`
+	Cost  int         `yaml:"cost"` // стоимость больше емкости бакета или лимита окна политики уменьшается до них
+}
+
+// QuotaConfig конфигурация квот за длительные периоды. Квоты выключены, если limits пуст
+type QuotaConfig struct {
+	Key      KeyExtractorConfig `yaml:"key"`      // способ определения клиента, по умолчанию как rate_limit.key
+	Timezone string             `yaml:"timezone"` // часовой пояс IANA для границ периодов, по умолчанию UTC
+	Status   int                `yaml:"status"`   // статус ответа при исчерпании квоты: 429 (по умолчанию) или 403
+	Limits   []QuotaLimitConfig `yaml:"limits"`
 }
 
+// QuotaLimitConfig квота за календарный период
+type QuotaLimitConfig struct {
+	Period string `yaml:"period"` // day, month
+	Limit  int64  `yaml:"limit"`
+}
+
+// HybridConfig конфигурация двухуровневого лимитера для бакетов токенов
+type HybridConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Batch    int           `yaml:"batch"`     // количество токенов, арендуемых за одно обращение к хранилищу, по умолчанию 10
+	LeaseTTL time.Duration `yaml:"lease_ttl"` // время, после которого неиспользованные токены возвращаются, по умолчанию 1s
+}
+
+// MemoryStoreConfig конфигурация хранилища лимитов в памяти процесса
+type MemoryStoreConfig struct {
+	Shards          int           `yaml:"shards"`           // количество шардов, по умолчанию 64
+	BucketTTL       time.Duration `yaml:"bucket_ttl"`       // время простоя, после которого заполненный бакет удаляется, 0 - не удалять
+	CleanupInterval time.Duration `yaml:"cleanup_interval"` // период удаления устаревших записей, по умолчанию 1m
+}
+
+// PolicyConfig конфигурация политики ограничения запросов для группы маршрутов
+type PolicyConfig struct {
+	Name      string             `yaml:"name"`
+	Match     MatchConfig        `yaml:"match"`
+	Algorithm string             `yaml:"algorithm"` // token_bucket (по умолчанию), fixed_window
+	Mode      string             `yaml:"mode"`      // enforce (по умолчанию), shadow - только записывать решения, не отклоняя запросы
+	Key       KeyExtractorConfig `yaml:"key"`
+	Bucket    BucketConfig       `yaml:"bucket"` // лимиты token_bucket
+	Limit     int                `yaml:"limit"`  // количество запросов в окне для fixed_window
+	Window    time.Duration      `yaml:"window"` // длительность окна для fixed_window
+}
+
+// MatchConfig условия применения политики, пустые условия совпадают с любым запросом
+type MatchConfig struct {
+	PathPrefix string   `yaml:"path_prefix"`
+	PathRegex  string   `yaml:"path_regex"`
+	Methods    []string `yaml:"methods"`
+	Hosts      []string `yaml:"hosts"` // поддерживается маска *.example.com
+}
+
+// KeyExtractorConfig конфигурация извлечения ключа клиента из запроса
+type KeyExtractorConfig struct {
+	Type     string               `yaml:"type"`                 // remote_ip, header, cookie, jwt_claim, path, composite
+	Name     string               `yaml:"name"`                 // имя заголовка, cookie или claim
+	Header   string               `yaml:"header"`               // заголовок с JWT токеном, по умолчанию Authorization
+	Secret   string               `yaml:"secret" secret:"true"` // HMAC секрет для проверки подписи JWT, пустой - без проверки
+	Template string               `yaml:"template"`             // шаблон пути, например /tenants/{tenant}/
+	Parts    []KeyExtractorConfig `yaml:"parts"`                // извлекатели для composite
+	Fallback *KeyExtractorConfig  `yaml:"fallback"`             // извлекатель, если ключ не найден
+}
+
+// RedisConfig конфигурация Redis
 type RedisConfig struct {
-	Addr     string `yaml:"addr"`
-	Password string `yaml:"password"`
-	DB       int    `yaml:"db"`
+	Mode       string   `yaml:"mode"`        // single (по умолчанию), sentinel, cluster
+	Addr       string   `yaml:"addr"`        // адрес Redis в режиме single
+	Addrs      []string `yaml:"addrs"`       // адреса sentinel или узлов кластера
+	MasterName string   `yaml:"master_name"` // имя мастера в режиме sentinel
+	Username   string   `yaml:"username"`    // пользователь ACL (Redis 6+), пустой - аутентификация только паролем
+	Password   string   `yaml:"password" secret:"true"`
+	DB         int      `yaml:"db"` // в режиме cluster допускается только 0
+
+	TLS RedisTLSConfig `yaml:"tls"`
+
+	PingInterval time.Duration `yaml:"ping_interval"` // период проверки доступности Redis
 }
 
-// LoadConfig загружает конфигурацию из файла
+// RedisTLSConfig конфигурация TLS соединения с Redis
+type RedisTLSConfig struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`   // сертификат CA, по умолчанию системные
+	CertFile           string `yaml:"cert_file"` // сертификат клиента для mTLS
+	KeyFile            string `yaml:"key_file"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// LoadConfig загружает конфигурацию из файла YAML, JSON или TOML, формат определяется по расширению.
+// Порядок применения значений описан в README: значения по умолчанию, файл с подстановкой ${VAR},
+// затем переопределения CLOUDRU_* и CLOUDRU_*_FILE, затем проверка
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	format, err := FileFormat(path)
 	if err != nil {
 		return nil, err
 	}
 
-	var config Config
-	err = yaml.Unmarshal(data, &config)
+	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
-	config.BalancerConfig.Backends, err = LoadBackends(config.BalancerConfig.BackedsFile)
+	config := Default()
+	err = Unmarshal(format, data, config)
 	if err != nil {
 		return nil, err
 	}
 
-	return &config, nil
+	if err := interpolate(config); err != nil {
+		return nil, err
+	}
+
+	if err := applyEnv(config); err != nil {
+		return nil, err
+	}
+	config.applyDefaults()
+
+	if config.BalancerConfig.BackedsFile != "" {
+		if len(config.BalancerConfig.Backends) > 0 {
+			return nil, ValidationErrors{{Path: "balancer.backends", Message: "must not be set together with balancer.backends_file"}}
+		}
+		config.BalancerConfig.Backends, err = readBackends(config.BalancerConfig.BackedsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
 }
 
-// LoadBackends загружает бэкенды из файла
+// LoadBackends загружает бэкенды из файла и проверяет их адреса
 func LoadBackends(path string) ([]BackendConfig, error) {
+	backends, err := readBackends(path)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &validator{}
+	validateBackends(v, path, backends)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return backends, nil
+}
+
+// ValidateBackend проверяет адрес и вес бэкенда, добавляемого без изменения файлов конфигурации
+func ValidateBackend(b BackendConfig) error {
+	v := &validator{}
+	validateBackend(v, "backend", b)
+	return v.err()
+}
+
+// readBackends читает бэкенды из файла YAML, JSON или TOML без проверки.
+// В YAML и JSON файл содержит список бэкендов, в TOML - таблицы [[backends]]
+func readBackends(path string) ([]BackendConfig, error) {
+	format, err := FileFormat(path)
+	if err != nil {
+		return nil, err
+	}
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
+
+	if format == FormatTOML {
+		var file struct {
+			Backends []BackendConfig `yaml:"backends"`
+		}
+		err = Unmarshal(format, data, &file)
+		return file.Backends, err
+	}
 	var backends []BackendConfig
-	err = yaml.Unmarshal(data, &backends)
+	err = Unmarshal(format, data, &backends)
+	return backends, err
+}
+
+// LoadIPLists загружает списки адресов из файла
+func LoadIPLists(path string) (IPListsConfig, error) {
+	var lists IPListsConfig
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return lists, err
 	}
-	return backends, nil
+	err = yaml.Unmarshal(data, &lists)
+	return lists, err
 }
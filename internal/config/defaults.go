@@ -0,0 +1,99 @@
+package config
+
+import "time"
+
+// Default возвращает конфигурацию со значениями по умолчанию.
+// YAML файл разбирается поверх нее, поэтому незаданные поля получают эти значения
+func Default() *Config {
+	return &Config{
+		HTTPConfig: HTTPConfig{
+			ListenPort:   8080,
+			ReadTimeout:  10,
+			WriteTimeout: 10,
+		},
+		AdminConfig: AdminConfig{
+			ListenAddr: "127.0.0.1",
+		},
+		RetryConfig: RetryConfig{
+			MaxAttempts: 3,
+			Delay:       500 * time.Millisecond,
+			MaxDelay:    3 * time.Second,
+		},
+		BalancerConfig: BalancerConfig{
+			Strategy:            "round_robin",
+			HealthCheckInterval: 10 * time.Second,
+		},
+		LoggerConfig: LoggerConfig{
+			LogLevel:  "info",
+			LogFormat: "json",
+			LogOutput: "stdout",
+		},
+		BucketConfig: BucketConfig{
+			Capacity:  10,
+			RefilRate: 1,
+			RefilTime: time.Second,
+		},
+		ConcurrencyConfig: ConcurrencyConfig{
+			LeaseTTL: 30 * time.Second,
+		},
+		RateLimitConfig: RateLimitConfig{
+			Key:                   KeyExtractorConfig{Type: "remote_ip"},
+			OverridesSyncInterval: 10 * time.Second,
+			OnStoreError:          "deny",
+			Storage:               "redis",
+			Memory: MemoryStoreConfig{
+				Shards:          64,
+				CleanupInterval: time.Minute,
+			},
+			Hybrid: HybridConfig{
+				Batch:    10,
+				LeaseTTL: time.Second,
+			},
+			Quota: QuotaConfig{
+				Timezone: "UTC",
+				Status:   429,
+			},
+			Ban: BanConfig{
+				Window:       time.Minute,
+				Duration:     time.Minute,
+				MaxDuration:  time.Hour,
+				Reset:        time.Hour,
+				SyncInterval: 5 * time.Second,
+			},
+		},
+		RedisConfig: RedisConfig{
+			Mode:         "single",
+			Addr:         "localhost:6379",
+			PingInterval: time.Second,
+		},
+		HistoryConfig: HistoryConfig{
+			Size: 10,
+		},
+	}
+}
+
+// applyDefaults заполняет значения по умолчанию, которые зависят от других полей
+// или относятся к элементам списков
+func (c *Config) applyDefaults() {
+	bucketDefaults(&c.BucketConfig)
+	for i := range c.RateLimitConfig.Policies {
+		p := &c.RateLimitConfig.Policies[i]
+		if p.Algorithm == "" {
+			p.Algorithm = "token_bucket"
+		}
+		if p.Mode == "" {
+			p.Mode = "enforce"
+		}
+		if p.Algorithm == "token_bucket" {
+			bucketDefaults(&p.Bucket)
+		}
+	}
+}
+
+// bucketDefaults новый бакет по умолчанию создается заполненным, явно заданный 0 сохраняется
+func bucketDefaults(b *BucketConfig) {
+	if b.Tokens == nil {
+		tokens := b.Capacity
+		b.Tokens = &tokens
+	}
+}
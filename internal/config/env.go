@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// EnvPrefix префикс переменных окружения, переопределяющих поля конфигурации
+	EnvPrefix = "CLOUDRU_"
+	// EnvConfigPath переменная окружения с путем к файлу конфигурации
+	EnvConfigPath = EnvPrefix + "CONFIG"
+	// envFileSuffix суффикс переменной окружения, значение поля для которой читается из файла
+	envFileSuffix = "_FILE"
+)
+
+// envRef подстановка ${VAR} или ${VAR:-default} в строковых значениях файла конфигурации
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolate подставляет значения переменных окружения в строковые поля разобранной конфигурации.
+// Подстановка после разбора не меняет структуру файла и не затрагивает комментарии.
+// Для незаданной переменной используется значение по умолчанию, без него возвращается ошибка
+func interpolate(cfg *Config) error {
+	var missing []string
+	interpolateValue(reflect.ValueOf(cfg).Elem(), &missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("undefined environment variables: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// interpolateValue подставляет переменные окружения во все строки значения v
+func interpolateValue(v reflect.Value, missing *[]string) {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(envRef.ReplaceAllStringFunc(v.String(), func(ref string) string {
+			m := envRef.FindStringSubmatch(ref)
+			if value, ok := os.LookupEnv(m[1]); ok {
+				return value
+			}
+			if strings.HasPrefix(m[2], ":-") {
+				return m[3]
+			}
+			*missing = append(*missing, m[1])
+			return ref
+		}))
+	case reflect.Pointer:
+		if !v.IsNil() {
+			interpolateValue(v.Elem(), missing)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			interpolateValue(v.Index(i), missing)
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				interpolateValue(v.Field(i), missing)
+			}
+		}
+	}
+}
+
+// EnvName возвращает имя переменной окружения для поля с YAML путем path, например
+// redis.password -> CLOUDRU_REDIS_PASSWORD
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(path, ".", "_"))
+}
+
+// applyEnv переопределяет поля конфигурации переменными окружения CLOUDRU_*.
+// Строки берутся как есть, остальные значения разбираются как YAML, например
+// CLOUDRU_CLIENT_IP_TRUSTED_PROXIES="[10.0.0.0/8]". Переменная с суффиксом _FILE задает файл,
+// из которого читается значение, например CLOUDRU_REDIS_PASSWORD_FILE=/run/secrets/redis
+func applyEnv(cfg *Config) error {
+	known := map[string]bool{EnvConfigPath: true}
+	var errs []string
+	walkFields(reflect.ValueOf(cfg).Elem(), "", func(field reflect.Value, path string) {
+		name := EnvName(path)
+		known[name], known[name+envFileSuffix] = true, true
+
+		value, ok, err := lookupEnv(name)
+		if err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		if !ok {
+			return
+		}
+		if err := setField(field, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+		}
+	})
+
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, EnvPrefix) && !known[name] {
+			slog.Warn("Unknown config environment variable", "name", name)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment overrides: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// lookupEnv возвращает значение переменной name или содержимое файла из name_FILE
+func lookupEnv(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	file, fromFile := os.LookupEnv(name + envFileSuffix)
+	switch {
+	case ok && fromFile:
+		return "", false, fmt.Errorf("%s and %s are both set", name, name+envFileSuffix)
+	case fromFile:
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", name+envFileSuffix, err)
+		}
+		// файлы секретов обычно заканчиваются переводом строки
+		return strings.TrimRight(string(data), "\r\n"), true, nil
+	default:
+		return value, ok, nil
+	}
+}
+
+// setField записывает значение переменной окружения в поле
+func setField(field reflect.Value, value string) error {
+	if field.Kind() == reflect.String {
+		field.SetString(value)
+		return nil
+	}
+	ptr := reflect.New(field.Type())
+	if err := yaml.UnmarshalStrict([]byte(value), ptr.Interface()); err != nil {
+		return err
+	}
+	field.Set(ptr.Elem())
+	return nil
+}
+
+// walkFields вызывает fn для каждого поля конфигурации, кроме вложенных структур, с его YAML путем
+func walkFields(v reflect.Value, path string, fn func(field reflect.Value, path string)) {
+	if v.Kind() != reflect.Struct {
+		fn(v, path)
+		return
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+		walkFields(v.Field(i), name, fn)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfig записывает минимальную корректную конфигурацию с дополнительными строками extra
+func writeConfig(t *testing.T, extra string) string {
+	t.Helper()
+	dir := t.TempDir()
+	backends := filepath.Join(dir, "backends.yaml")
+	require.NoError(t, os.WriteFile(backends, []byte("- url: http://backend:8000\n"), 0o644))
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+http:
+  listen_port: 8080
+balancer:
+  strategy: round_robin
+  backends_file: `+backends+`
+  health_check_interval: 10s
+bucket:
+  capacity: 10
+  refil_time: 1s
+`+extra), 0o644))
+	return path
+}
+
+func TestLoadConfigEnv(t *testing.T) {
+	secret := filepath.Join(t.TempDir(), "redis_password")
+	require.NoError(t, os.WriteFile(secret, []byte("s3cret\n"), 0o600))
+
+	t.Setenv("REDIS_HOST", "redis.internal")
+	t.Setenv("CLOUDRU_BUCKET_CAPACITY", "20")
+	t.Setenv("CLOUDRU_BALANCER_HEALTH_CHECK_INTERVAL", "5s")
+	t.Setenv("CLOUDRU_CLIENT_IP_TRUSTED_PROXIES", "[10.0.0.0/8, 192.168.0.1]")
+	t.Setenv("CLOUDRU_CLIENT_IP_HEADER", "X-Forwarded-For")
+	t.Setenv("CLOUDRU_REDIS_PASSWORD_FILE", secret)
+
+	cfg, err := LoadConfig(writeConfig(t, `
+redis:
+  addr: "${REDIS_HOST}:${REDIS_PORT:-6379}"
+  password: plain
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "redis.internal:6379", cfg.RedisConfig.Addr)
+	assert.Equal(t, "s3cret", cfg.RedisConfig.Password)
+	assert.Equal(t, 20, cfg.BucketConfig.Capacity)
+	assert.Equal(t, 5*time.Second, cfg.BalancerConfig.HealthCheckInterval)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.0.1"}, cfg.ClientIPConfig.TrustedProxies)
+
+	t.Setenv("CLOUDRU_REDIS_PASSWORD", "other")
+	_, err = LoadConfig(writeConfig(t, "redis:\n  addr: redis:6379\n"))
+	assert.ErrorContains(t, err, "CLOUDRU_REDIS_PASSWORD and CLOUDRU_REDIS_PASSWORD_FILE are both set")
+
+	_, err = LoadConfig(writeConfig(t, "redis:\n  addr: ${UNDEFINED_REDIS_ADDR}\n"))
+	assert.ErrorContains(t, err, "undefined environment variables: UNDEFINED_REDIS_ADDR")
+}
+
+func TestLoadConfigInterpolateLiteral(t *testing.T) {
+	// значение переменной не может изменить структуру файла
+	t.Setenv("REDIS_PASSWORD", "x\nadmin:\n  token: injected")
+
+	cfg, err := LoadConfig(writeConfig(t, `
+redis:
+  addr: redis:6379 # ${UNDEFINED_IN_COMMENT}
+  password: ${REDIS_PASSWORD}
+`))
+	require.NoError(t, err)
+	assert.Equal(t, "x\nadmin:\n  token: injected", cfg.RedisConfig.Password)
+	assert.Empty(t, cfg.AdminConfig.Token)
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// FormatTOML формат файла конфигурации TOML
+const FormatTOML = "toml"
+
+// FileFormat определяет формат файла по расширению: .yaml, .yml, .json или .toml
+func FileFormat(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML, nil
+	case ".json":
+		return FormatJSON, nil
+	case ".toml":
+		return FormatTOML, nil
+	default:
+		return "", fmt.Errorf("unknown config format of %s, must be .yaml, .yml, .json or .toml", path)
+	}
+}
+
+// Unmarshal разбирает data в формате format в out.
+// JSON и TOML приводятся к YAML, поэтому имена полей, длительности и строгая проверка
+// неизвестных полей одинаковы для всех форматов
+func Unmarshal(format string, data []byte, out interface{}) error {
+	var v interface{}
+	switch format {
+	case FormatYAML:
+		return yaml.UnmarshalStrict(data, out)
+	case FormatJSON:
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+	case FormatTOML:
+		var m map[string]interface{}
+		if _, err := toml.Decode(string(data), &m); err != nil {
+			return err
+		}
+		v = m
+	default:
+		return fmt.Errorf("unknown config format %q", format)
+	}
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return yaml.UnmarshalStrict(data, out)
+}
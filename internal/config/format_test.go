@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFormats(t *testing.T) {
+	dir := t.TempDir()
+	tomlBackends := filepath.Join(dir, "backends.toml")
+	require.NoError(t, os.WriteFile(tomlBackends, []byte("[[backends]]\nurl = \"http://backend:8001\"\n"), 0o644))
+
+	files := map[string]string{
+		"config.json": `{
+  "balancer": {"backends": [{"url": "http://backend:8000"}], "health_check_interval": "5s"},
+  "bucket": {"capacity": 20}
+}`,
+		"config.toml": `
+[balancer]
+health_check_interval = "5s"
+
+[[balancer.backends]]
+url = "http://backend:8000"
+
+[bucket]
+capacity = 20
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+			cfg, err := LoadConfig(path)
+			require.NoError(t, err)
+			assert.Equal(t, []BackendConfig{{URL: "http://backend:8000"}}, cfg.BalancerConfig.Backends)
+			assert.Equal(t, 5*time.Second, cfg.BalancerConfig.HealthCheckInterval)
+			assert.Equal(t, 20, cfg.BucketConfig.Capacity)
+		})
+	}
+
+	path := filepath.Join(dir, "file.toml")
+	require.NoError(t, os.WriteFile(path, []byte("[balancer]\nbackends_file = \""+tomlBackends+"\"\n"), 0o644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, []BackendConfig{{URL: "http://backend:8001"}}, cfg.BalancerConfig.Backends)
+
+	path = filepath.Join(dir, "unknown.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"balancer": {"backends": [{"url": "http://backend:8000"}]}, "unknown": 1}`), 0o644))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "field unknown not found")
+
+	_, err = LoadConfig(filepath.Join(dir, "config.ini"))
+	assert.ErrorContains(t, err, "unknown config format")
+}
+
+func TestLoadConfigBackends(t *testing.T) {
+	_, err := LoadConfig(writeConfig(t, "  tokens: 1\n"))
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("http:\n  listen_port: 8080\n"), 0o644))
+	_, err = LoadConfig(path)
+	assert.EqualError(t, err, "invalid config: balancer.backends: is required when balancer.backends_file is not set")
+
+	t.Setenv("CLOUDRU_BALANCER_BACKENDS", "[{url: http://backend:8001}]")
+	_, err = LoadConfig(writeConfig(t, ""))
+	assert.EqualError(t, err, "invalid config: balancer.backends: must not be set together with balancer.backends_file")
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// FormatYAML вывод конфигурации в YAML
+	FormatYAML = "yaml"
+	// FormatJSON вывод конфигурации в JSON
+	FormatJSON = "json"
+
+	// redacted значение, которым заменяются секреты
+	redacted = "[REDACTED]"
+)
+
+// Redacted возвращает копию конфигурации, в которой непустые поля с тегом secret:"true" заменены на [REDACTED]
+func (c *Config) Redacted() (*Config, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	copied := &Config{}
+	if err := yaml.Unmarshal(data, copied); err != nil {
+		return nil, err
+	}
+
+	redact(reflect.ValueOf(copied).Elem())
+	return copied, nil
+}
+
+// Printable возвращает копию конфигурации для команды config print: секреты скрыты, а бэкенды
+// из backends_file не выводятся, чтобы вывод можно было загрузить как файл конфигурации
+func (c *Config) Printable() (*Config, error) {
+	printable, err := c.Redacted()
+	if err != nil {
+		return nil, err
+	}
+	if printable.BalancerConfig.BackedsFile != "" {
+		printable.BalancerConfig.Backends = nil
+	}
+	return printable, nil
+}
+
+// redact заменяет секреты во вложенных структурах, списках и указателях
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if !v.IsNil() {
+			redact(v.Elem())
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			redact(v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			if field.Tag.Get("secret") == "true" && v.Field(i).Kind() == reflect.String && v.Field(i).String() != "" {
+				v.Field(i).SetString(redacted)
+				continue
+			}
+			redact(v.Field(i))
+		}
+	}
+}
+
+// Marshal возвращает конфигурацию в формате YAML или JSON с именами полей и длительностями как в YAML файле
+func Marshal(c *Config, format string) ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatYAML:
+		return data, nil
+	case FormatJSON:
+		var v interface{}
+		if err := yaml.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		return json.MarshalIndent(jsonValue(v), "", "  ")
+	default:
+		return nil, fmt.Errorf("unknown format %q, must be %s or %s", format, FormatYAML, FormatJSON)
+	}
+}
+
+// jsonValue преобразует результат разбора YAML в значения, которые поддерживает encoding/json
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonValue(value)
+		}
+		return m
+	case []interface{}:
+		for i := range v {
+			v[i] = jsonValue(v[i])
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	dir := t.TempDir()
+	backends := filepath.Join(dir, "backends.yaml")
+	require.NoError(t, os.WriteFile(backends, []byte("- url: http://backend:8000\n"), 0o644))
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("balancer:\n  backends_file: "+backends+"\n"), 0o644))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	def := Default()
+	assert.Equal(t, def.HTTPConfig, cfg.HTTPConfig)
+	assert.Equal(t, def.RetryConfig, cfg.RetryConfig)
+	assert.Equal(t, def.BucketConfig.Capacity, *cfg.BucketConfig.Tokens)
+	assert.Equal(t, def.BalancerConfig.HealthCheckInterval, cfg.BalancerConfig.HealthCheckInterval)
+}
+
+func TestLoadConfigZeroTokens(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `  tokens: 0
+redis:
+  addr: redis:6379
+rate_limit:
+  policies:
+    - name: login
+      bucket:
+        capacity: 5
+        tokens: 0
+    - name: search
+      bucket:
+        capacity: 5
+`))
+	require.NoError(t, err)
+	// явно заданный 0 создает пустые бакеты, незаданное значение - заполненные
+	assert.Equal(t, 0, cfg.BucketConfig.InitialTokens())
+	assert.Equal(t, 0, cfg.RateLimitConfig.Policies[0].Bucket.InitialTokens())
+	assert.Equal(t, 5, cfg.RateLimitConfig.Policies[1].Bucket.InitialTokens())
+}
+
+func TestPrintable(t *testing.T) {
+	path := writeConfig(t, "redis:\n  addr: redis:6379\n")
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	require.Len(t, cfg.BalancerConfig.Backends, 1)
+
+	printable, err := cfg.Printable()
+	require.NoError(t, err)
+	assert.Empty(t, printable.BalancerConfig.Backends)
+	assert.Len(t, cfg.BalancerConfig.Backends, 1)
+
+	// вывод загружается обратно вместе с backends_file
+	data, err := Marshal(printable, FormatYAML)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o644))
+	loaded, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, cfg.BalancerConfig.Backends, loaded.BalancerConfig.Backends)
+}
+
+func TestRedacted(t *testing.T) {
+	cfg, err := LoadConfig(writeConfig(t, `
+admin:
+  listen_port: 8081
+  token: admin-token-0123456789
+redis:
+  password: redis-password
+rate_limit:
+  key:
+    type: jwt_claim
+    name: sub
+    fallback:
+      type: jwt_claim
+      name: tenant
+      secret: jwt-secret
+`))
+	require.NoError(t, err)
+
+	redacted, err := cfg.Redacted()
+	require.NoError(t, err)
+	assert.Equal(t, "[REDACTED]", redacted.AdminConfig.Token)
+	assert.Equal(t, "[REDACTED]", redacted.RedisConfig.Password)
+	assert.Equal(t, "[REDACTED]", redacted.RateLimitConfig.Key.Fallback.Secret)
+	assert.Empty(t, redacted.RateLimitConfig.Key.Secret)
+	assert.Equal(t, "admin-token-0123456789", cfg.AdminConfig.Token)
+	assert.Equal(t, "jwt-secret", cfg.RateLimitConfig.Key.Fallback.Secret)
+
+	data, err := Marshal(redacted, FormatJSON)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "redis-password")
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.Equal(t, "10s", out["balancer"].(map[string]interface{})["health_check_interval"])
+
+	_, err = Marshal(redacted, "xml")
+	assert.Error(t, err)
+}
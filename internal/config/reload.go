@@ -0,0 +1,60 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ReloadResult результат перезагрузки или отката конфигурации
+type ReloadResult struct {
+	Applied         []string `json:"applied"`          // поля, изменения которых применены
+	RestartRequired []string `json:"restart_required"` // поля, изменения которых вступят в силу после перезапуска
+}
+
+// liveFields секции и поля, изменения которых применяются без перезапуска.
+// Должны соответствовать полям, которые копирует WithLive
+var liveFields = []string{
+	"logger",
+	"bucket",
+	"retry",
+	"balancer.health_check_interval",
+	"balancer.backends",
+}
+
+// WithLive возвращает копию конфигурации, в которой поля, изменяемые без перезапуска, взяты из next
+func (c *Config) WithLive(next *Config) *Config {
+	applied := *c
+	applied.LoggerConfig = next.LoggerConfig
+	applied.BucketConfig = next.BucketConfig
+	applied.RetryConfig = next.RetryConfig
+	applied.BalancerConfig.HealthCheckInterval = next.BalancerConfig.HealthCheckInterval
+	applied.BalancerConfig.Backends = next.BalancerConfig.Backends
+	return &applied
+}
+
+// RequiresRestart проверяет, нужен ли перезапуск, чтобы применить изменение поля path
+func RequiresRestart(path string) bool {
+	for _, live := range liveFields {
+		if path == live || strings.HasPrefix(path, live+".") {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff возвращает YAML пути полей, значения которых в old и next различаются.
+// Поля без YAML представления не сравниваются
+func Diff(old, next *Config) []string {
+	nextFields := make(map[string]reflect.Value)
+	walkFields(reflect.ValueOf(next).Elem(), "", func(field reflect.Value, path string) {
+		nextFields[path] = field
+	})
+
+	var paths []string
+	walkFields(reflect.ValueOf(old).Elem(), "", func(field reflect.Value, path string) {
+		if !reflect.DeepEqual(field.Interface(), nextFields[path].Interface()) {
+			paths = append(paths, path)
+		}
+	})
+	return paths
+}
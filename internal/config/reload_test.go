@@ -0,0 +1,35 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		HTTPConfig:     HTTPConfig{ListenPort: 8080},
+		BucketConfig:   BucketConfig{Capacity: 10, RefilTime: time.Second},
+		BalancerConfig: BalancerConfig{HealthCheckInterval: time.Second, Backends: []BackendConfig{{URL: "a"}}},
+	}
+	next := *old
+	next.HTTPConfig.ListenPort = 9090
+	next.BucketConfig.Capacity = 20
+	next.BalancerConfig.Backends = []BackendConfig{{URL: "b"}}
+	next.RateLimitConfig.Policies = []PolicyConfig{{Name: "p"}}
+
+	paths := Diff(old, &next)
+	assert.Equal(t, []string{"http.listen_port", "balancer.backends", "bucket.capacity", "rate_limit.policies"}, paths)
+
+	assert.True(t, RequiresRestart("http.listen_port"))
+	assert.False(t, RequiresRestart("bucket.capacity"))
+	assert.False(t, RequiresRestart("balancer.health_check_interval"))
+	assert.False(t, RequiresRestart("balancer.backends"))
+	assert.True(t, RequiresRestart("balancer.strategy"))
+
+	applied := old.WithLive(&next)
+	assert.Equal(t, 8080, applied.HTTPConfig.ListenPort)
+	assert.Equal(t, 20, applied.BucketConfig.Capacity)
+	assert.Equal(t, next.BalancerConfig.Backends, applied.BalancerConfig.Backends)
+}
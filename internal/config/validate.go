@@ -0,0 +1,315 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// minAdminTokenLength минимальная длина токена административного API
+	minAdminTokenLength = 16
+	// maxBackendWeight максимальный вес бэкенда, длина расписания балансировщика не больше суммы весов
+	maxBackendWeight = 1000
+)
+
+// placeholderTokens значения токена из примеров, которые нельзя использовать
+var placeholderTokens = map[string]bool{
+	"change-me":        true,
+	"changeme":         true,
+	"change-me-please": true,
+	"secret":           true,
+	"token":            true,
+	"admin":            true,
+}
+
+// FieldError ошибка в значении поля конфигурации
+type FieldError struct {
+	Path    string // YAML путь к полю, например rate_limit.policies[0].window
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors все ошибки конфигурации
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "invalid config: " + strings.Join(messages, "; ")
+}
+
+// validator собирает ошибки конфигурации
+type validator struct {
+	errs ValidationErrors
+}
+
+// check добавляет ошибку поля path, если условие ok не выполнено
+func (v *validator) check(ok bool, path, format string, args ...any) {
+	if !ok {
+		v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// oneOf проверяет, что значение поля входит в допустимые
+func (v *validator) oneOf(value, path string, allowed ...string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	v.check(false, path, "must be one of %s, got %q", strings.Join(allowed, ", "), value)
+}
+
+// err возвращает ошибки или nil, если их нет
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Validate проверяет конфигурацию и возвращает все найденные ошибки в ValidationErrors
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check(c.HTTPConfig.ListenPort > 0 && c.HTTPConfig.ListenPort <= 65535, "http.listen_port", "must be between 1 and 65535")
+	v.check(c.HTTPConfig.ReadTimeout >= 0, "http.read_timeout", "must not be negative")
+	v.check(c.HTTPConfig.WriteTimeout >= 0, "http.write_timeout", "must not be negative")
+
+	if c.AdminConfig.ListenPort != 0 {
+		v.check(c.AdminConfig.ListenPort > 0 && c.AdminConfig.ListenPort <= 65535, "admin.listen_port", "must be between 1 and 65535")
+		v.check(c.AdminConfig.ListenPort != c.HTTPConfig.ListenPort, "admin.listen_port", "must differ from http.listen_port")
+		v.check(c.AdminConfig.Token != "", "admin.token", "is required when admin server is enabled")
+		switch token := c.AdminConfig.Token; {
+		case token == "":
+		case placeholderTokens[strings.ToLower(token)]:
+			v.check(false, "admin.token", "must not be a placeholder value")
+		default:
+			v.check(len(token) >= minAdminTokenLength, "admin.token", "must be at least %d characters long", minAdminTokenLength)
+		}
+		if c.AdminConfig.ListenAddr != "" {
+			_, err := netip.ParseAddr(c.AdminConfig.ListenAddr)
+			v.check(err == nil, "admin.listen_addr", "invalid IP address %q", c.AdminConfig.ListenAddr)
+		}
+	}
+
+	for i, p := range c.ClientIPConfig.TrustedProxies {
+		v.check(validPrefix(p), fmt.Sprintf("client_ip.trusted_proxies[%d]", i), "invalid CIDR or IP %q", p)
+	}
+	if len(c.ClientIPConfig.TrustedProxies) > 0 {
+		v.check(c.ClientIPConfig.Header != "", "client_ip.header", "is required when client_ip.trusted_proxies is set")
+	}
+	if c.ClientIPConfig.Header != "" {
+		v.oneOf(http.CanonicalHeaderKey(c.ClientIPConfig.Header), "client_ip.header", "Forwarded", "X-Forwarded-For", "X-Real-Ip")
+	}
+
+	v.check(c.RetryConfig.MaxAttempts >= 0, "retry.max_attempts", "must not be negative")
+	v.check(c.RetryConfig.Delay >= 0, "retry.delay", "must not be negative")
+	v.check(c.RetryConfig.MaxDelay == 0 || c.RetryConfig.MaxDelay >= c.RetryConfig.Delay, "retry.max_delay", "must not be less than retry.delay")
+
+	v.oneOf(c.BalancerConfig.Strategy, "balancer.strategy", "round_robin")
+	v.check(c.BalancerConfig.HealthCheckInterval > 0, "balancer.health_check_interval", "must be positive")
+	if c.BalancerConfig.BackedsFile != "" {
+		validateBackends(v, "balancer.backends_file", c.BalancerConfig.Backends)
+	} else {
+		v.check(len(c.BalancerConfig.Backends) > 0, "balancer.backends", "is required when balancer.backends_file is not set")
+		validateBackends(v, "balancer.backends", c.BalancerConfig.Backends)
+	}
+
+	v.oneOf(strings.ToLower(c.LoggerConfig.LogLevel), "logger.log_level", "", "debug", "info", "warn", "warning", "error")
+	v.oneOf(strings.ToLower(c.LoggerConfig.LogFormat), "logger.log_format", "", "json", "text")
+
+	validateBucket(v, "bucket", c.BucketConfig)
+	v.check(c.BucketConfig.RefilTime > 0, "bucket.refil_time", "must be positive")
+
+	v.check(c.ConcurrencyConfig.MaxInFlight >= 0, "concurrency.max_in_flight", "must not be negative")
+	v.check(c.ConcurrencyConfig.LeaseTTL >= 0, "concurrency.lease_ttl", "must not be negative")
+	v.oneOf(c.ConcurrencyConfig.Storage, "concurrency.storage", "", "redis", "memory")
+	validateKey(v, "concurrency.key", c.ConcurrencyConfig.Key)
+
+	validateRateLimit(v, c.RateLimitConfig)
+	if c.usesRedis() {
+		validateRedis(v, c.RedisConfig)
+	}
+
+	v.check(c.HistoryConfig.Size >= 0, "history.size", "must not be negative")
+
+	return v.err()
+}
+
+// validateRateLimit проверяет секцию rate_limit
+func validateRateLimit(v *validator, c RateLimitConfig) {
+	validateKey(v, "rate_limit.key", c.Key)
+	v.oneOf(c.OnStoreError, "rate_limit.on_store_error", "", "allow", "deny", "local")
+	v.oneOf(c.Storage, "rate_limit.storage", "", "redis", "memory")
+	v.check(c.Memory.Shards >= 0, "rate_limit.memory.shards", "must not be negative")
+
+	if c.Hybrid.Enabled {
+		v.check(c.Hybrid.Batch >= 0, "rate_limit.hybrid.batch", "must not be negative")
+		v.check(c.Hybrid.LeaseTTL >= 0, "rate_limit.hybrid.lease_ttl", "must not be negative")
+	}
+
+	names := make(map[string]bool, len(c.Policies))
+	for i, p := range c.Policies {
+		path := fmt.Sprintf("rate_limit.policies[%d]", i)
+		v.check(p.Name != "", path+".name", "is required")
+		v.check(!names[p.Name], path+".name", "duplicate policy %q", p.Name)
+		names[p.Name] = true
+		v.oneOf(p.Mode, path+".mode", "", "enforce", "shadow")
+		validateMatch(v, path+".match", p.Match)
+		validateKey(v, path+".key", p.Key)
+
+		switch p.Algorithm {
+		case "", "token_bucket":
+			validateBucket(v, path+".bucket", p.Bucket)
+		case "fixed_window":
+			v.check(p.Limit > 0, path+".limit", "must be positive")
+			v.check(p.Window > 0, path+".window", "must be positive")
+		default:
+			v.oneOf(p.Algorithm, path+".algorithm", "token_bucket", "fixed_window")
+		}
+	}
+
+	validateKey(v, "rate_limit.quota.key", c.Quota.Key)
+	if c.Quota.Timezone != "" {
+		_, err := time.LoadLocation(c.Quota.Timezone)
+		v.check(err == nil, "rate_limit.quota.timezone", "unknown timezone %q", c.Quota.Timezone)
+	}
+	v.check(c.Quota.Status == 0 || c.Quota.Status == 429 || c.Quota.Status == 403, "rate_limit.quota.status", "must be 429 or 403")
+	periods := make(map[string]bool, len(c.Quota.Limits))
+	for i, l := range c.Quota.Limits {
+		path := fmt.Sprintf("rate_limit.quota.limits[%d]", i)
+		v.oneOf(l.Period, path+".period", "day", "month")
+		v.check(!periods[l.Period], path+".period", "duplicate period %q", l.Period)
+		periods[l.Period] = true
+		v.check(l.Limit > 0, path+".limit", "must be positive")
+	}
+
+	for i, r := range c.Cost.Rules {
+		path := fmt.Sprintf("rate_limit.cost.rules[%d]", i)
+		validateMatch(v, path+".match", r.Match)
+		v.check(r.Cost > 0, path+".cost", "must be positive")
+	}
+
+	if c.Ban.Threshold != 0 {
+		v.check(c.Ban.Threshold > 0, "rate_limit.ban.threshold", "must not be negative")
+		v.check(c.Ban.Window > 0, "rate_limit.ban.window", "must be positive")
+		v.check(c.Ban.Duration > 0, "rate_limit.ban.duration", "must be positive")
+		v.check(c.Ban.MaxDuration == 0 || c.Ban.MaxDuration >= c.Ban.Duration, "rate_limit.ban.max_duration", "must not be less than duration")
+		v.check(c.Ban.Reset >= 0, "rate_limit.ban.reset", "must not be negative")
+		validateKey(v, "rate_limit.ban.key", c.Ban.Key)
+	}
+}
+
+// usesRedis возвращает true, если хотя бы одно хранилище лимитов находится в Redis
+func (c *Config) usesRedis() bool {
+	return c.RateLimitConfig.Storage != "memory" || c.ConcurrencyConfig.Storage == "redis"
+}
+
+// validateRedis проверяет секцию redis
+func validateRedis(v *validator, c RedisConfig) {
+	switch c.Mode {
+	case "", "single":
+		v.check(c.Addr != "" || len(c.Addrs) > 0, "redis.addr", "is required")
+	case "sentinel":
+		v.check(c.MasterName != "", "redis.master_name", "is required in sentinel mode")
+		v.check(len(c.Addrs) > 0, "redis.addrs", "is required in sentinel mode")
+	case "cluster":
+		v.check(len(c.Addrs) > 0, "redis.addrs", "is required in cluster mode")
+		v.check(c.DB == 0, "redis.db", "must be 0 in cluster mode")
+	default:
+		v.oneOf(c.Mode, "redis.mode", "single", "sentinel", "cluster")
+	}
+	v.check(c.DB >= 0, "redis.db", "must not be negative")
+	v.check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "redis.tls", "cert_file and key_file must be set together")
+}
+
+// validateBucket проверяет лимиты бакета
+func validateBucket(v *validator, path string, c BucketConfig) {
+	v.check(c.Capacity > 0, path+".capacity", "must be positive")
+	v.check(c.RefilRate >= 0, path+".refil_rate", "must not be negative")
+	v.check(c.Tokens == nil || *c.Tokens >= 0 && *c.Tokens <= c.Capacity, path+".tokens", "must be between 0 and capacity")
+}
+
+// validateMatch проверяет условия совпадения запроса
+func validateMatch(v *validator, path string, c MatchConfig) {
+	if c.PathRegex != "" {
+		_, err := regexp.Compile(c.PathRegex)
+		v.check(err == nil, path+".path_regex", "%v", err)
+	}
+}
+
+// validateKey проверяет способ определения клиента
+func validateKey(v *validator, path string, c KeyExtractorConfig) {
+	switch c.Type {
+	case "", "remote_ip":
+	case "header", "cookie", "jwt_claim":
+		v.check(c.Name != "", path+".name", "is required for %s", c.Type)
+	case "path":
+		v.check(c.Template != "", path+".template", "is required for path")
+	case "composite":
+		v.check(len(c.Parts) > 0, path+".parts", "is required for composite")
+		for i, part := range c.Parts {
+			validateKey(v, fmt.Sprintf("%s.parts[%d]", path, i), part)
+		}
+	default:
+		v.oneOf(c.Type, path+".type", "remote_ip", "header", "cookie", "jwt_claim", "path", "composite")
+	}
+	if c.Fallback != nil {
+		validateKey(v, path+".fallback", *c.Fallback)
+	}
+}
+
+// validateBackends проверяет адреса бэкендов
+func validateBackends(v *validator, path string, backends []BackendConfig) {
+	seen := make(map[string]bool, len(backends))
+	for i, b := range backends {
+		p := fmt.Sprintf("%s[%d]", path, i)
+		validateBackend(v, p, b)
+		u := NormalizeBackendURL(b.URL)
+		v.check(!seen[u], p+".url", "duplicate backend URL %q", b.URL)
+		seen[u] = true
+	}
+}
+
+// validateBackend проверяет адрес и вес бэкенда
+func validateBackend(v *validator, path string, b BackendConfig) {
+	u, err := url.Parse(b.URL)
+	v.check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		path+".url", "invalid backend URL %q", b.URL)
+	v.check(b.Weight >= 0 && b.Weight <= maxBackendWeight, path+".weight", "must be between 0 and %d", maxBackendWeight)
+}
+
+// NormalizeBackendURL приводит адрес бэкенда к виду для сравнения: схема и хост в нижнем регистре,
+// без завершающего слеша. Некорректный адрес возвращается как есть
+func NormalizeBackendURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// validPrefix проверяет CIDR или одиночный IP адрес
+func validPrefix(s string) bool {
+	if strings.Contains(s, "/") {
+		_, err := netip.ParsePrefix(s)
+		return err == nil
+	}
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
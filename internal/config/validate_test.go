@@ -0,0 +1,107 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := &Config{
+		HTTPConfig:     HTTPConfig{ListenPort: 8080},
+		AdminConfig:    AdminConfig{ListenPort: 8080},
+		BalancerConfig: BalancerConfig{Strategy: "random", BackedsFile: "b.yaml", Backends: []BackendConfig{{URL: "backend:80"}}},
+		BucketConfig:   BucketConfig{Capacity: 10},
+		RateLimitConfig: RateLimitConfig{
+			Policies: []PolicyConfig{{Name: "login", Algorithm: "fixed_window", Limit: 1}},
+		},
+		RedisConfig: RedisConfig{Addr: "redis:6379"},
+	}
+
+	err := cfg.Validate()
+	var errs ValidationErrors
+	require.True(t, errors.As(err, &errs))
+
+	paths := make([]string, len(errs))
+	for i, e := range errs {
+		paths[i] = e.Path
+	}
+	assert.Equal(t, []string{
+		"admin.listen_port",
+		"admin.token",
+		"balancer.strategy",
+		"balancer.health_check_interval",
+		"balancer.backends_file[0].url",
+		"bucket.refil_time",
+		"rate_limit.policies[0].window",
+	}, paths)
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	backends := filepath.Join(dir, "backends.yaml")
+	require.NoError(t, os.WriteFile(backends, []byte("- url: http://backend:8000\n"), 0o644))
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+http:
+  listen_port: 8080
+balancer:
+  strategy: round_robin
+  backends_file: `+backends+`
+  health_check_interval: 10s
+bucket:
+  capacity: 10
+  refil_time: 0s
+redis:
+  addr: redis:6379
+`), 0o644))
+
+	_, err := LoadConfig(path)
+	assert.EqualError(t, err, "invalid config: bucket.refil_time: must be positive")
+
+	require.NoError(t, os.WriteFile(path, []byte("bucket:\n  refill_rate: 1\n"), 0o644))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "field refill_rate not found")
+
+}
+
+func TestValidateRedisStorage(t *testing.T) {
+	cfg := Default()
+	cfg.BalancerConfig.Backends = []BackendConfig{{URL: "http://backend:80"}}
+	cfg.RedisConfig.Addr = ""
+	assert.EqualError(t, cfg.Validate(), "invalid config: redis.addr: is required")
+
+	// секция redis не проверяется, если лимиты хранятся в памяти
+	cfg.RateLimitConfig.Storage = "memory"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.ConcurrencyConfig.Storage = "redis"
+	assert.EqualError(t, cfg.Validate(), "invalid config: redis.addr: is required")
+}
+
+func TestValidateAdminToken(t *testing.T) {
+	cfg := Default()
+	cfg.BalancerConfig.Backends = []BackendConfig{{URL: "http://backend:80"}}
+	cfg.RedisConfig.Addr = "redis:6379"
+	cfg.AdminConfig.ListenPort = 8081
+
+	for token, want := range map[string]string{
+		"":                       "invalid config: admin.token: is required when admin server is enabled",
+		"change-me":              "invalid config: admin.token: must not be a placeholder value",
+		"short":                  "invalid config: admin.token: must be at least 16 characters long",
+		"0123456789abcdef-token": "",
+	} {
+		cfg.AdminConfig.Token = token
+		err := cfg.Validate()
+		if want == "" {
+			assert.NoError(t, err, token)
+		} else {
+			assert.EqualError(t, err, want, token)
+		}
+	}
+	assert.Equal(t, "127.0.0.1", cfg.AdminConfig.ListenAddr)
+}
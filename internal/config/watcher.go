@@ -1,29 +1,59 @@
 package config
 
 import (
+	"context"
+	"errors"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
-// Watcher наблюдатель за изменениями в файле
+// DefaultDebounce время тишины после последнего события, через которое вызывается обработчик
+const DefaultDebounce = 100 * time.Millisecond
+
+// Watcher наблюдатель за изменениями в файле.
+// Наблюдает за каталогом файла, а не за самим файлом, поэтому переживает замену файла
+// через rename (редакторы, mv) и подмену символической ссылки (ConfigMap в Kubernetes)
 type Watcher struct {
-	watcher *fsnotify.Watcher
+	watcher  *fsnotify.Watcher
+	path     string // абсолютный путь к файлу
+	dir      string
+	realPath string // путь к файлу после разрешения символических ссылок
+	debounce time.Duration
 }
 
 // NewWatcher создает новый наблюдатель для файла
-func NewWatcher(filepath string) (*Watcher, error) {
-	watcher, err := fsnotify.NewWatcher()
+func NewWatcher(path string) (*Watcher, error) {
+	path, err := filepath.Abs(path)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
 
-	err = watcher.Add(filepath)
+	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
 	}
 
-	return &Watcher{watcher: watcher}, nil
+	w := &Watcher{
+		watcher:  watcher,
+		path:     path,
+		dir:      filepath.Dir(path),
+		debounce: DefaultDebounce,
+	}
+	w.realPath, _ = filepath.EvalSymlinks(path)
+
+	if err := watcher.Add(w.dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return w, nil
 }
 
 // Close закрывает наблюдатель
@@ -33,22 +63,76 @@ func (w *Watcher) Close() {
 	}
 }
 
-// DoRun запускает горутину, которая наблюдает за изменениями в файле и вызывает функцию fn при изменении файла
-func (w *Watcher) DoRun(fn func()) {
+// DoRun запускает горутину, которая наблюдает за изменениями в файле и вызывает функцию fn
+// после серии изменений, когда файл существует. Наблюдатель закрывается при отмене ctx
+func (w *Watcher) DoRun(ctx context.Context, fn func()) {
 	go func() {
+		defer w.Close()
+
+		timer := time.NewTimer(w.debounce)
+		timer.Stop()
+		defer timer.Stop()
+
+		// rewatch повторяет попытки вернуть наблюдение за каталогом, пока он отсутствует
+		rewatch := time.NewTicker(time.Second)
+		rewatch.Stop()
+		defer rewatch.Stop()
+
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case event, ok := <-w.watcher.Events:
 				if !ok {
 					return
 				}
-				if event.Op&fsnotify.Write == fsnotify.Write {
-					slog.Info("modified file", "file", event.Name)
-					fn()
+				if event.Name == w.dir && event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					slog.Warn("watched directory removed", "dir", w.dir)
+					rewatch.Reset(time.Second)
+					continue
+				}
+				if w.changed(event) {
+					timer.Reset(w.debounce)
+				}
+			case <-rewatch.C:
+				if err := w.watcher.Add(w.dir); err == nil {
+					slog.Info("watching directory again", "dir", w.dir)
+					rewatch.Stop()
+					timer.Reset(w.debounce)
+				}
+			case <-timer.C:
+				if _, err := os.Stat(w.path); err != nil {
+					if !errors.Is(err, os.ErrNotExist) {
+						slog.Error("error checking watched file", "file", w.path, "error", err)
+					}
+					continue
+				}
+				slog.Info("modified file", "file", w.path)
+				fn()
+			case err, ok := <-w.watcher.Errors:
+				if !ok {
+					return
 				}
-			case err := <-w.watcher.Errors:
 				slog.Error("error", "error", err)
 			}
 		}
 	}()
 }
+
+// changed проверяет, относится ли событие в каталоге к наблюдаемому файлу
+func (w *Watcher) changed(event fsnotify.Event) bool {
+	if event.Op == fsnotify.Chmod {
+		return false
+	}
+	if filepath.Clean(event.Name) == w.path {
+		return true
+	}
+
+	// файл может быть символической ссылкой, цель которой подменили
+	realPath, err := filepath.EvalSymlinks(w.path)
+	if err != nil || realPath == w.realPath {
+		return false
+	}
+	w.realPath = realPath
+	return true
+}
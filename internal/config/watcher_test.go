@@ -0,0 +1,89 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("a"), 0o644))
+
+	w, err := NewWatcher(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := make(chan struct{}, 10)
+	w.DoRun(ctx, func() { calls <- struct{}{} })
+
+	expectCall := func(msg string) {
+		t.Helper()
+		select {
+		case <-calls:
+		case <-time.After(2 * time.Second):
+			t.Fatal(msg)
+		}
+		select {
+		case <-calls:
+			t.Fatal("events are not debounced: " + msg)
+		case <-time.After(3 * DefaultDebounce):
+		}
+	}
+
+	// серия записей вызывает обработчик один раз
+	for i := 0; i < 5; i++ {
+		require.NoError(t, os.WriteFile(path, []byte("b"), 0o644))
+	}
+	expectCall("write")
+
+	// замена файла через rename, после которой наблюдение за самим файлом было бы потеряно
+	for i := 0; i < 2; i++ {
+		tmp := filepath.Join(dir, "config.yaml.tmp")
+		require.NoError(t, os.WriteFile(tmp, []byte("c"), 0o644))
+		require.NoError(t, os.Rename(tmp, path))
+		expectCall("rename")
+	}
+
+	cancel()
+	time.Sleep(3 * DefaultDebounce)
+	require.NoError(t, os.WriteFile(path, []byte("d"), 0o644))
+	select {
+	case <-calls:
+		t.Fatal("watcher is not stopped by context")
+	case <-time.After(3 * DefaultDebounce):
+	}
+}
+
+func TestWatcherSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "v1"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v1", "config.yaml"), []byte("a"), 0o644))
+	require.NoError(t, os.Symlink("v1", filepath.Join(dir, "..data")))
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.Symlink(filepath.Join("..data", "config.yaml"), path))
+
+	w, err := NewWatcher(path)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := make(chan struct{}, 10)
+	w.DoRun(ctx, func() { calls <- struct{}{} })
+
+	// так ConfigMap обновляется в Kubernetes: новая версия в новом каталоге и атомарная подмена ссылки ..data
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "v2"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "v2", "config.yaml"), []byte("b"), 0o644))
+	require.NoError(t, os.Symlink("v2", filepath.Join(dir, "..data_tmp")))
+	require.NoError(t, os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")))
+
+	select {
+	case <-calls:
+	case <-time.After(2 * time.Second):
+		t.Fatal("symlink swap is not detected")
+	}
+}
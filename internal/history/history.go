@@ -0,0 +1,229 @@
+// Package history хранит историю примененных конфигураций для аудита и отката
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+const (
+	// SourceStartup конфигурация загружена при запуске
+	SourceStartup = "startup"
+	// SourceReload конфигурация перезагружена после изменения файла или по запросу
+	SourceReload = "reload"
+	// SourceBackendsFile изменился файл с бэкендами
+	SourceBackendsFile = "backends_file"
+	// SourceRollback выполнен откат к предыдущей версии
+	SourceRollback = "rollback"
+	// SourceAdmin бэкенды изменены через административный API
+	SourceAdmin = "admin"
+)
+
+var (
+	// ErrRevisionNotFound ошибка, если версия конфигурации не найдена
+	ErrRevisionNotFound = errors.New("revision not found")
+)
+
+// Revision версия примененной конфигурации
+type Revision struct {
+	ID              int            `json:"id"`
+	Time            time.Time      `json:"time"`
+	Source          string         `json:"source"`
+	RollbackOf      int            `json:"rollback_of,omitempty"`      // версия, к которой выполнен откат
+	Changed         []string       `json:"changed,omitempty"`          // YAML пути полей, измененных относительно предыдущей версии
+	BackendsAdded   []string       `json:"backends_added,omitempty"`   // адреса добавленных бэкендов
+	BackendsRemoved []string       `json:"backends_removed,omitempty"` // адреса удаленных бэкендов
+	Config          *config.Config `json:"-"`                          // конфигурация со скрытыми секретами
+}
+
+// record строка файла журнала
+type record struct {
+	Revision
+	Config json.RawMessage `json:"config"`
+}
+
+// History последние версии примененной конфигурации.
+// Конфигурации хранятся со скрытыми секретами, поэтому при откате секреты не меняются
+type History struct {
+	mu        sync.RWMutex
+	size      int
+	file      string
+	revisions []Revision
+	lastID    int
+}
+
+// New создает историю и загружает версии из файла журнала, если он задан
+func New(cfg config.HistoryConfig) (*History, error) {
+	h := &History{
+		size: cfg.Size,
+		file: cfg.File,
+	}
+	if h.file != "" {
+		if err := h.load(); err != nil {
+			return nil, fmt.Errorf("failed to load config history: %w", err)
+		}
+	}
+	return h, nil
+}
+
+// Record добавляет версию cfg, полученную из source, если она отличается от последней
+func (h *History) Record(source string, cfg *config.Config) (Revision, error) {
+	return h.record(source, 0, cfg)
+}
+
+// RecordRollback добавляет версию cfg, полученную откатом к версии id
+func (h *History) RecordRollback(id int, cfg *config.Config) (Revision, error) {
+	return h.record(SourceRollback, id, cfg)
+}
+
+// Revisions возвращает версии от старых к новым
+func (h *History) Revisions() []Revision {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return slices.Clone(h.revisions)
+}
+
+// Revision возвращает версию id
+func (h *History) Revision(id int) (Revision, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, rev := range h.revisions {
+		if rev.ID == id {
+			return rev, nil
+		}
+	}
+	return Revision{}, ErrRevisionNotFound
+}
+
+// record добавляет версию и перезаписывает файл журнала
+func (h *History) record(source string, rollbackOf int, cfg *config.Config) (Revision, error) {
+	if h.size == 0 {
+		return Revision{}, nil
+	}
+
+	redacted, err := cfg.Redacted()
+	if err != nil {
+		return Revision{}, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rev := Revision{
+		Time:       time.Now(),
+		Source:     source,
+		RollbackOf: rollbackOf,
+		Config:     redacted,
+	}
+	if n := len(h.revisions); n > 0 {
+		prev := h.revisions[n-1]
+		rev.Changed = config.Diff(prev.Config, redacted)
+		if len(rev.Changed) == 0 {
+			return prev, nil
+		}
+		rev.BackendsAdded = subtract(redacted.BalancerConfig.Backends, prev.Config.BalancerConfig.Backends)
+		rev.BackendsRemoved = subtract(prev.Config.BalancerConfig.Backends, redacted.BalancerConfig.Backends)
+	}
+	h.add(rev)
+	rev = h.revisions[len(h.revisions)-1]
+
+	slog.Info("Config revision recorded", "id", rev.ID, "source", source, "changed", rev.Changed,
+		"backends_added", rev.BackendsAdded, "backends_removed", rev.BackendsRemoved)
+
+	if h.file != "" {
+		if err := h.save(); err != nil {
+			return rev, fmt.Errorf("failed to save config history: %w", err)
+		}
+	}
+	return rev, nil
+}
+
+// add добавляет версию с очередным номером и удаляет версии сверх size
+func (h *History) add(rev Revision) {
+	if rev.ID == 0 {
+		rev.ID = h.lastID + 1
+	}
+	h.lastID = max(h.lastID, rev.ID)
+	h.revisions = append(h.revisions, rev)
+	if len(h.revisions) > h.size {
+		h.revisions = slices.Delete(h.revisions, 0, len(h.revisions)-h.size)
+	}
+}
+
+// load читает версии из файла журнала, отсутствующий файл - пустая история
+func (h *History) load() error {
+	f, err := os.Open(h.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	for {
+		var rec record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rev := rec.Revision
+		rev.Config = &config.Config{}
+		if err := config.Unmarshal(config.FormatJSON, rec.Config, rev.Config); err != nil {
+			return fmt.Errorf("revision %d: %w", rev.ID, err)
+		}
+		h.add(rev)
+	}
+}
+
+// save атомарно перезаписывает файл журнала текущими версиями
+func (h *History) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(h.file), filepath.Base(h.file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	enc := json.NewEncoder(tmp)
+	for _, rev := range h.revisions {
+		data, err := config.Marshal(rev.Config, config.FormatJSON)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		if err := enc.Encode(record{Revision: rev, Config: data}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), h.file)
+}
+
+// subtract возвращает адреса бэкендов из a, которых нет в b
+func subtract(a, b []config.BackendConfig) []string {
+	var urls []string
+	for _, backend := range a {
+		if !slices.Contains(b, backend) {
+			urls = append(urls, backend.URL)
+		}
+	}
+	return urls
+}
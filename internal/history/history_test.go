@@ -0,0 +1,59 @@
+package history
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+func TestHistory(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "history.jsonl")
+	h, err := New(config.HistoryConfig{Size: 2, File: file})
+	require.NoError(t, err)
+
+	cfg := config.Default()
+	cfg.RedisConfig.Password = "secret"
+	cfg.BalancerConfig.Backends = []config.BackendConfig{{URL: "http://a"}, {URL: "http://b"}}
+	first, err := h.Record(SourceStartup, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, first.ID)
+	assert.Equal(t, "[REDACTED]", first.Config.RedisConfig.Password)
+
+	// конфигурация без изменений не добавляется
+	same, err := h.Record(SourceReload, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 1, same.ID)
+
+	next := *cfg
+	next.BalancerConfig.Backends = []config.BackendConfig{{URL: "http://b"}, {URL: "http://c"}}
+	rev, err := h.Record(SourceBackendsFile, &next)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"balancer.backends"}, rev.Changed)
+	assert.Equal(t, []string{"http://c"}, rev.BackendsAdded)
+	assert.Equal(t, []string{"http://a"}, rev.BackendsRemoved)
+
+	rev, err = h.RecordRollback(1, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, 3, rev.ID)
+	assert.Equal(t, 1, rev.RollbackOf)
+
+	// хранятся только последние size версий
+	_, err = h.Revision(1)
+	assert.ErrorIs(t, err, ErrRevisionNotFound)
+
+	loaded, err := New(config.HistoryConfig{Size: 2, File: file})
+	require.NoError(t, err)
+	revisions := loaded.Revisions()
+	require.Len(t, revisions, 2)
+	assert.Equal(t, 2, revisions[0].ID)
+	assert.Equal(t, []string{"http://c"}, revisions[0].BackendsAdded)
+	assert.Equal(t, cfg.BalancerConfig.Backends, revisions[1].Config.BalancerConfig.Backends)
+	assert.Equal(t, cfg.BucketConfig, revisions[1].Config.BucketConfig)
+
+	rev, err = loaded.Record(SourceReload, &next)
+	require.NoError(t, err)
+	assert.Equal(t, 4, rev.ID)
+}
@@ -0,0 +1,172 @@
+// Package ipfilter фильтрует клиентов по спискам CIDR
+package ipfilter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/vakhrushevk/cloudru/internal/clientip"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+// lists разобранные списки адресов
+type lists struct {
+	access *Trie[bool] // true - адрес разрешен, false - запрещен
+	exempt *Trie[struct{}]
+}
+
+// Filter отклоняет запросы клиентов из запрещенных сетей и пропускает клиентов
+// из списка исключений мимо ограничителей запросов.
+// Из пересекающихся разрешенного и запрещенного префиксов действует более длинный,
+// поэтому из запрещенной сети можно разрешить отдельные адреса.
+// Списки заменяются атомарно и могут обновляться во время работы
+type Filter struct {
+	lists atomic.Pointer[lists]
+}
+
+// New создает фильтр по спискам адресов
+func New(cfg config.IPListsConfig) (*Filter, error) {
+	f := &Filter{}
+	if err := f.Update(cfg); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Load создает фильтр по спискам из файла и перечитывает файл при его изменении, пока не отменен ctx.
+// Если обновленный файл некорректен, продолжают действовать прежние списки
+func Load(ctx context.Context, path string) (*Filter, error) {
+	cfg, err := config.LoadIPLists(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ip lists: %w", err)
+	}
+	f, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := config.NewWatcher(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch ip lists: %w", err)
+	}
+	watcher.DoRun(ctx, func() {
+		cfg, err := config.LoadIPLists(path)
+		if err == nil {
+			err = f.Update(cfg)
+		}
+		if err != nil {
+			slog.Error("Failed to reload ip lists", "file", path, "error", err)
+			return
+		}
+		slog.Info("IP lists reloaded", "file", path,
+			"allow", len(cfg.Allow), "deny", len(cfg.Deny), "exempt", len(cfg.Exempt))
+	})
+
+	return f, nil
+}
+
+// Update заменяет списки адресов
+func (f *Filter) Update(cfg config.IPListsConfig) error {
+	l := &lists{access: NewTrie[bool](), exempt: NewTrie[struct{}]()}
+
+	// разрешенные префиксы добавляются последними и заменяют такие же запрещенные
+	for _, s := range cfg.Deny {
+		prefix, err := parsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid deny entry %q: %w", s, err)
+		}
+		l.access.Insert(prefix, false)
+	}
+	for _, s := range cfg.Allow {
+		prefix, err := parsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid allow entry %q: %w", s, err)
+		}
+		l.access.Insert(prefix, true)
+	}
+	for _, s := range cfg.Exempt {
+		prefix, err := parsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid exempt entry %q: %w", s, err)
+		}
+		l.exempt.Insert(prefix, struct{}{})
+	}
+
+	f.lists.Store(l)
+	return nil
+}
+
+// parsePrefix разбирает CIDR или одиночный IP адрес
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		if prefix.Addr().Is4In6() {
+			// префикс короче /96 захватывает адреса вне ::ffff:0:0/96 и не сводится к IPv4 CIDR
+			if prefix.Bits() < 96 {
+				return netip.Prefix{}, fmt.Errorf("IPv4-mapped prefix must be at least /96")
+			}
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix, nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// Allowed проверяет, разрешен ли доступ адресу
+func (f *Filter) Allowed(addr netip.Addr) bool {
+	allowed, _, ok := f.lists.Load().access.Lookup(addr)
+	return !ok || allowed
+}
+
+// Exempt проверяет, входит ли адрес в список исключений
+func (f *Filter) Exempt(addr netip.Addr) bool {
+	_, _, ok := f.lists.Load().exempt.Lookup(addr)
+	return ok
+}
+
+// Middleware отклоняет запросы клиентов из запрещенных сетей, запросы клиентов
+// из списка исключений передает в exempt, остальные в next.
+// Запросы с нераспознанным адресом клиента передаются в next
+func (f *Filter) Middleware(next, exempt http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientip.FromRequest(r)
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		addr = addr.Unmap().WithZone("")
+
+		if !f.Allowed(addr) {
+			slog.Debug("Client IP denied", "ip", ip)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"code":  "403",
+				"error": "Forbidden",
+			})
+			return
+		}
+
+		if f.Exempt(addr) {
+			exempt.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,95 @@
+package ipfilter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+func TestTrieLookup(t *testing.T) {
+	trie := NewTrie[string]()
+	trie.Insert(netip.MustParsePrefix("10.0.0.0/8"), "wide")
+	trie.Insert(netip.MustParsePrefix("10.1.0.0/16"), "narrow")
+	trie.Insert(netip.MustParsePrefix("2001:db8::/32"), "v6")
+
+	tests := []struct {
+		addr  string
+		value string
+		bits  int
+		ok    bool
+	}{
+		{addr: "10.2.3.4", value: "wide", bits: 8, ok: true},
+		{addr: "10.1.3.4", value: "narrow", bits: 16, ok: true},
+		{addr: "::ffff:10.1.3.4", value: "narrow", bits: 16, ok: true},
+		{addr: "11.0.0.1"},
+		{addr: "2001:db8::1", value: "v6", bits: 32, ok: true},
+		{addr: "2001:db9::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			value, bits, ok := trie.Lookup(netip.MustParseAddr(tt.addr))
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.value, value)
+			assert.Equal(t, tt.bits, bits)
+		})
+	}
+}
+
+func TestFilterMiddleware(t *testing.T) {
+	filter, err := New(config.IPListsConfig{
+		Allow:  []string{"203.0.113.7"},
+		Deny:   []string{"203.0.113.0/24", "2001:db8::/32"},
+		Exempt: []string{"10.0.0.0/8"},
+	})
+	require.NoError(t, err)
+
+	handler := filter.Middleware(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }),
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusAccepted) }),
+	)
+
+	tests := []struct {
+		remoteAddr string
+		status     int
+	}{
+		{remoteAddr: "198.51.100.1:1000", status: http.StatusOK},
+		{remoteAddr: "203.0.113.8:1000", status: http.StatusForbidden},
+		{remoteAddr: "203.0.113.7:1000", status: http.StatusOK},
+		{remoteAddr: "[2001:db8::5]:1000", status: http.StatusForbidden},
+		{remoteAddr: "10.20.30.40:1000", status: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.remoteAddr, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+		})
+	}
+
+	_, err = New(config.IPListsConfig{Deny: []string{"10.0.0.0/33"}})
+	assert.Error(t, err)
+}
+
+func TestParsePrefix(t *testing.T) {
+	prefix, err := parsePrefix("::ffff:10.0.0.0/104")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("10.0.0.0/8"), prefix)
+
+	_, err = parsePrefix("::ffff:1.2.3.4/64")
+	assert.Error(t, err)
+
+	prefix, err = parsePrefix("::ffff:1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParsePrefix("1.2.3.4/32"), prefix)
+}
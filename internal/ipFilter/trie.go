@@ -0,0 +1,72 @@
+package ipfilter
+
+import (
+	"net/netip"
+)
+
+// node узел бинарного префиксного дерева
+type node[V any] struct {
+	children [2]*node[V]
+	value    V
+	set      bool
+}
+
+// Trie бинарное префиксное дерево для поиска самого длинного префикса, содержащего адрес.
+// IPv4 и IPv6 хранятся в отдельных деревьях, поиск выполняется за число бит адреса
+type Trie[V any] struct {
+	v4 *node[V]
+	v6 *node[V]
+}
+
+// NewTrie создает пустое дерево
+func NewTrie[V any]() *Trie[V] {
+	return &Trie[V]{v4: &node[V]{}, v6: &node[V]{}}
+}
+
+// root возвращает корень дерева для семейства адреса
+func (t *Trie[V]) root(addr netip.Addr) *node[V] {
+	if addr.Is4() {
+		return t.v4
+	}
+	return t.v6
+}
+
+// Insert добавляет префикс со значением, заменяя значение существующего префикса
+func (t *Trie[V]) Insert(prefix netip.Prefix, value V) {
+	prefix = prefix.Masked()
+	addr := prefix.Addr()
+	bytes := addr.AsSlice()
+
+	n := t.root(addr)
+	for i := 0; i < prefix.Bits(); i++ {
+		b := bit(bytes, i)
+		if n.children[b] == nil {
+			n.children[b] = &node[V]{}
+		}
+		n = n.children[b]
+	}
+	n.value, n.set = value, true
+}
+
+// Lookup возвращает значение самого длинного префикса, содержащего addr, и его длину
+func (t *Trie[V]) Lookup(addr netip.Addr) (value V, bits int, ok bool) {
+	addr = addr.Unmap()
+	bytes := addr.AsSlice()
+
+	n := t.root(addr)
+	for i := 0; n != nil; i++ {
+		if n.set {
+			value, bits, ok = n.value, i, true
+		}
+		if i == addr.BitLen() {
+			break
+		}
+		n = n.children[bit(bytes, i)]
+	}
+	return value, bits, ok
+}
+
+// bit возвращает i-й бит адреса, начиная со старшего
+func bit(bytes []byte, i int) int {
+	return int(bytes[i/8]>>(7-i%8)) & 1
+}
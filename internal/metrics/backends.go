@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
+)
+
+var (
+	backendUpDesc = prometheus.NewDesc(namespace+"_backend_up",
+		"Доступность бэкенда по последней проверке: 1 - доступен, 0 - нет.", []string{"pool", "backend"}, nil)
+	backendDrainingDesc = prometheus.NewDesc(namespace+"_backend_draining",
+		"Выведен ли бэкенд из балансировки: 1 - да, 0 - нет.", []string{"pool", "backend"}, nil)
+	backendWeightDesc = prometheus.NewDesc(namespace+"_backend_weight",
+		"Вес бэкенда.", []string{"pool", "backend"}, nil)
+	backendActiveDesc = prometheus.NewDesc(namespace+"_backend_active_requests",
+		"Запросы, которые выполняются бэкендом сейчас.", []string{"pool", "backend"}, nil)
+	backendLastCheckDesc = prometheus.NewDesc(namespace+"_backend_last_check_timestamp_seconds",
+		"Время последней проверки доступности бэкенда.", []string{"pool", "backend"}, nil)
+)
+
+// backendCollector собирает состояние бэкендов при каждом запросе метрик,
+// поэтому удаленные бэкенды сразу пропадают из метрик
+type backendCollector struct {
+	pool     string
+	backends func() []backend.Status
+}
+
+// RegisterBackends регистрирует метрики состояния бэкендов пула, которые возвращает backends
+func RegisterBackends(pool string, backends func() []backend.Status) error {
+	return registerBackends(registry, pool, backends)
+}
+
+// registerBackends регистрирует метрики состояния бэкендов пула в reg
+func registerBackends(reg prometheus.Registerer, pool string, backends func() []backend.Status) error {
+	return reg.Register(&backendCollector{pool: pool, backends: backends})
+}
+
+func (c *backendCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- backendUpDesc
+	ch <- backendDrainingDesc
+	ch <- backendWeightDesc
+	ch <- backendActiveDesc
+	ch <- backendLastCheckDesc
+}
+
+func (c *backendCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.backends() {
+		ch <- prometheus.MustNewConstMetric(backendUpDesc, prometheus.GaugeValue, boolValue(s.Alive), c.pool, s.URL)
+		ch <- prometheus.MustNewConstMetric(backendDrainingDesc, prometheus.GaugeValue, boolValue(s.Draining), c.pool, s.URL)
+		ch <- prometheus.MustNewConstMetric(backendWeightDesc, prometheus.GaugeValue, float64(s.Weight), c.pool, s.URL)
+		ch <- prometheus.MustNewConstMetric(backendActiveDesc, prometheus.GaugeValue, float64(s.Active), c.pool, s.URL)
+		if !s.LastCheck.IsZero() {
+			ch <- prometheus.MustNewConstMetric(backendLastCheckDesc, prometheus.GaugeValue,
+				float64(s.LastCheck.UnixNano())/1e9, c.pool, s.URL)
+		}
+	}
+}
+
+// boolValue преобразует bool в значение метрики
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,179 @@
+// Package metrics предоставляет метрики Prometheus балансировщика
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "cloudru"
+
+// DefaultPool пул бэкендов балансировщика, пока балансировщик обслуживает один пул
+const DefaultPool = "default"
+
+const (
+	// DecisionAllowed политика пропустила запрос
+	DecisionAllowed = "allowed"
+	// DecisionRejected политика отклонила запрос
+	DecisionRejected = "rejected"
+	// DecisionShadowRejected политика в режиме shadow отклонила бы запрос
+	DecisionShadowRejected = "shadow_rejected"
+	// DecisionError политика не смогла проверить запрос из-за ошибки хранилища
+	DecisionError = "error"
+)
+
+// registry реестр метрик, отдаваемых Handler
+var registry = prometheus.NewRegistry()
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Запросы, дошедшие до балансировщика, по пулу, бэкенду и классу кода ответа. Запросы, отклоненные ограничителями, не учитываются.",
+	}, []string{"pool", "backend", "status_class"})
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Время обработки запросов бэкендами по пулу, бэкенду и классу кода ответа.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"pool", "backend", "status_class"})
+
+	healthChecksTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "health_checks_total",
+		Help:      "Проверки доступности бэкендов по результату: success или failure.",
+	}, []string{"pool", "backend", "result"})
+
+	healthCheckDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "health_check_duration_seconds",
+		Help:      "Время проверки доступности бэкендов.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"pool", "backend"})
+
+	backendFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_failures_total",
+		Help:      "Запросы, завершившиеся ошибкой соединения с бэкендом.",
+	}, []string{"pool", "backend"})
+
+	failoversTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failovers_total",
+		Help:      "Переключения запросов на другой бэкенд после ошибки по результату: switched или unavailable.",
+	}, []string{"pool", "result"})
+
+	backendRetriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backend_retries_total",
+		Help:      "Попытки восстановить соединение с бэкендом после ошибки по результату: restored или failed.",
+	}, []string{"pool", "backend", "result"})
+
+	rateLimitDecisionsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "ratelimit_decisions_total",
+		Help:      "Решения политик ограничения запросов: allowed, rejected, shadow_rejected или error.",
+	}, []string{"policy", "decision"})
+
+	redisDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_operation_duration_seconds",
+		Help:      "Время выполнения операций Redis по операции и результату: ok или error.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"operation", "result"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := Register(registry); err != nil {
+		panic(err)
+	}
+}
+
+// Register регистрирует метрики балансировщика без метрик процесса в reg, например в отдельном реестре теста.
+// Значения метрик общие для всех реестров, поэтому тесты проверяют их изменение, а не значение
+func Register(reg prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		requestsTotal,
+		requestDuration,
+		healthChecksTotal,
+		healthCheckDuration,
+		backendFailuresTotal,
+		failoversTotal,
+		backendRetriesTotal,
+		rateLimitDecisionsTotal,
+		redisDuration,
+	} {
+		if err := reg.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler возвращает обработчик, отдающий метрики в формате Prometheus
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// ObserveRequest учитывает запрос, обработанный бэкендом backend или отклоненный балансировщиком, если backend пустой.
+// Запросы, отклоненные ограничителями до балансировщика, учитываются только в решениях политик RateLimitDecision
+func ObserveRequest(pool, backend string, status int, duration time.Duration) {
+	if backend == "" {
+		backend = "none"
+	}
+	class := strconv.Itoa(status/100) + "xx"
+	requestsTotal.WithLabelValues(pool, backend, class).Inc()
+	requestDuration.WithLabelValues(pool, backend, class).Observe(duration.Seconds())
+}
+
+// ObserveHealthCheck учитывает проверку доступности бэкенда
+func ObserveHealthCheck(pool, backend string, err error, duration time.Duration) {
+	healthChecksTotal.WithLabelValues(pool, backend, result(err == nil, "success", "failure")).Inc()
+	healthCheckDuration.WithLabelValues(pool, backend).Observe(duration.Seconds())
+}
+
+// BackendFailure учитывает запрос, завершившийся ошибкой соединения с бэкендом
+func BackendFailure(pool, backend string) {
+	backendFailuresTotal.WithLabelValues(pool, backend).Inc()
+}
+
+// Failover учитывает переключение запроса на другой бэкенд, switched - нашелся ли доступный бэкенд
+func Failover(pool string, switched bool) {
+	failoversTotal.WithLabelValues(pool, result(switched, "switched", "unavailable")).Inc()
+}
+
+// BackendRetry учитывает попытку восстановить соединение с бэкендом
+func BackendRetry(pool, backend string, restored bool) {
+	backendRetriesTotal.WithLabelValues(pool, backend, result(restored, "restored", "failed")).Inc()
+}
+
+// RateLimitDecision учитывает решение политики ограничения запросов
+func RateLimitDecision(policy, decision string) {
+	rateLimitDecisionsTotal.WithLabelValues(policy, decision).Inc()
+}
+
+// ObserveRedis учитывает операцию Redis, отсутствие ключа не считается ошибкой
+func ObserveRedis(operation string, err error, duration time.Duration) {
+	ok := err == nil || errors.Is(err, redis.Nil)
+	redisDuration.WithLabelValues(operation, result(ok, "ok", "error")).Observe(duration.Seconds())
+}
+
+// result возвращает значение метки в зависимости от ok
+func result(ok bool, success, failure string) string {
+	if ok {
+		return success
+	}
+	return failure
+}
@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/balancer/backend"
+)
+
+// newTestRegistry создает реестр теста с метриками балансировщика
+func newTestRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+	reg := prometheus.NewRegistry()
+	require.NoError(t, Register(reg))
+	return reg
+}
+
+func scrape(t *testing.T, reg *prometheus.Registry) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+// value возвращает значение счетчика или количество наблюдений гистограммы name с метками labels
+func value(t *testing.T, reg *prometheus.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue metrics
+				}
+			}
+			if h := m.GetHistogram(); h != nil {
+				return float64(h.GetSampleCount())
+			}
+			return m.GetCounter().GetValue() + m.GetGauge().GetValue()
+		}
+	}
+	return 0
+}
+
+func TestMetrics(t *testing.T) {
+	reg := newTestRegistry(t)
+	backends := []backend.Status{{URL: "http://a", Alive: true, Weight: 2}, {URL: "http://b", Draining: true, Weight: 1}}
+	require.NoError(t, registerBackends(reg, "test", func() []backend.Status { return backends }))
+
+	series := []struct {
+		name   string
+		labels map[string]string
+	}{
+		{"cloudru_requests_total", map[string]string{"backend": "http://a", "pool": "test", "status_class": "4xx"}},
+		{"cloudru_requests_total", map[string]string{"backend": "none", "pool": "test", "status_class": "5xx"}},
+		{"cloudru_request_duration_seconds", map[string]string{"backend": "http://a", "pool": "test", "status_class": "4xx"}},
+		{"cloudru_health_checks_total", map[string]string{"backend": "http://b", "pool": "test", "result": "failure"}},
+		{"cloudru_failovers_total", map[string]string{"pool": "test", "result": "unavailable"}},
+		{"cloudru_ratelimit_decisions_total", map[string]string{"decision": "rejected", "policy": "login"}},
+	}
+	before := make([]float64, len(series))
+	for i, s := range series {
+		before[i] = value(t, reg, s.name, s.labels)
+	}
+
+	ObserveRequest("test", "http://a", http.StatusNotFound, 10*time.Millisecond)
+	ObserveRequest("test", "", http.StatusServiceUnavailable, time.Millisecond)
+	ObserveHealthCheck("test", "http://b", errors.New("down"), time.Millisecond)
+	Failover("test", false)
+	RateLimitDecision("login", DecisionRejected)
+
+	for i, s := range series {
+		assert.Equal(t, before[i]+1, value(t, reg, s.name, s.labels), s.name)
+	}
+
+	out := scrape(t, reg)
+	for _, line := range []string{
+		`cloudru_backend_up{backend="http://a",pool="test"} 1`,
+		`cloudru_backend_draining{backend="http://b",pool="test"} 1`,
+		`cloudru_backend_weight{backend="http://a",pool="test"} 2`,
+	} {
+		assert.Contains(t, out, line)
+	}
+
+	// удаленный бэкенд пропадает из метрик
+	backends = backends[:1]
+	assert.NotContains(t, scrape(t, reg), `cloudru_backend_up{backend="http://b"`)
+}
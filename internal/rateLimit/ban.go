@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+const (
+	// defaultBanSyncInterval период синхронизации блокировок, если он не задан в конфигурации
+	defaultBanSyncInterval = 5 * time.Second
+	// violationsPrefix префикс счетчиков отказов в репозитории окон
+	violationsPrefix = "violations:"
+)
+
+// ErrInvalidBan ошибка, если конфигурация блокировок некорректна
+var ErrInvalidBan = errors.New("invalid ban config")
+
+// PenaltyBox временно блокирует клиентов, запросы которых отклоняются чаще threshold раз за window.
+// Блокировки хранятся в репозитории, общем для экземпляров балансировщика, а проверяются
+// по локальной копии, поэтому запросы заблокированного клиента не обращаются к хранилищу
+type PenaltyBox struct {
+	repo         repository.BanRepository
+	windowRepo   repository.WindowRepository
+	extractor    KeyExtractor
+	threshold    int
+	window       time.Duration
+	duration     time.Duration
+	maxDuration  time.Duration
+	reset        time.Duration
+	syncInterval time.Duration
+
+	mu   sync.RWMutex
+	bans map[string]time.Time // окончание блокировки по ключу клиента
+}
+
+// NewPenaltyBox создает блокировщик клиентов
+func NewPenaltyBox(repo repository.BanRepository, windowRepo repository.WindowRepository, extractor KeyExtractor, cfg config.BanConfig) (*PenaltyBox, error) {
+	if cfg.Threshold <= 0 || cfg.Window <= 0 || cfg.Duration <= 0 {
+		return nil, fmt.Errorf("%w: threshold, window and duration must be positive", ErrInvalidBan)
+	}
+	maxDuration := cfg.MaxDuration
+	if maxDuration == 0 {
+		maxDuration = cfg.Duration
+	}
+	if maxDuration < cfg.Duration {
+		return nil, fmt.Errorf("%w: max_duration is less than duration", ErrInvalidBan)
+	}
+	reset := cfg.Reset
+	if reset == 0 {
+		reset = maxDuration
+	}
+	syncInterval := cfg.SyncInterval
+	if syncInterval <= 0 {
+		syncInterval = defaultBanSyncInterval
+	}
+
+	return &PenaltyBox{
+		repo:         repo,
+		windowRepo:   windowRepo,
+		extractor:    FallbackExtractor(extractor, RemoteIPExtractor()),
+		threshold:    cfg.Threshold,
+		window:       cfg.Window,
+		duration:     cfg.Duration,
+		maxDuration:  maxDuration,
+		reset:        reset,
+		syncInterval: syncInterval,
+		bans:         make(map[string]time.Time),
+	}, nil
+}
+
+// StartSync периодически загружает блокировки из репозитория,
+// чтобы блокировки, сделанные другими экземплярами балансировщика, действовали и здесь
+func (b *PenaltyBox) StartSync(ctx context.Context) {
+	if err := b.sync(ctx); err != nil {
+		slog.Error("Failed to load bans", "error", err)
+	}
+
+	ticker := time.NewTicker(b.syncInterval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.sync(ctx); err != nil {
+					slog.Error("Failed to sync bans", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// sync заменяет локальную копию блокировок данными из репозитория
+func (b *PenaltyBox) sync(ctx context.Context) error {
+	bans, err := b.repo.Bans(ctx)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]time.Time, len(bans))
+	for _, ban := range bans {
+		m[ban.Key] = ban.Until
+	}
+
+	b.mu.Lock()
+	b.bans = m
+	b.mu.Unlock()
+	return nil
+}
+
+// banned возвращает оставшееся время блокировки клиента по локальной копии
+func (b *PenaltyBox) banned(key string, now time.Time) (time.Duration, bool) {
+	b.mu.RLock()
+	until, ok := b.bans[key]
+	b.mu.RUnlock()
+	if !ok || !now.Before(until) {
+		return 0, false
+	}
+	return until.Sub(now), true
+}
+
+// violation учитывает отказ в запросе клиента и блокирует клиента, если отказов набралось threshold
+func (b *PenaltyBox) violation(ctx context.Context, key string) {
+	count, _, err := b.windowRepo.Increment(ctx, violationsPrefix+key, 1, b.window)
+	if err != nil {
+		slog.Error("Failed to count rate limit violation", "key", logKey(key), "error", err)
+		return
+	}
+	if count < b.threshold {
+		return
+	}
+
+	ban, err := b.repo.Ban(ctx, key, b.duration, b.maxDuration, b.reset)
+	if err != nil {
+		slog.Error("Failed to ban client", "key", logKey(key), "error", err)
+		return
+	}
+	slog.Warn("Client banned", "key", logKey(key), "until", ban.Until, "strikes", ban.Strikes)
+
+	b.mu.Lock()
+	b.bans[key] = ban.Until
+	b.mu.Unlock()
+}
+
+// Bans возвращает действующие блокировки
+func (b *PenaltyBox) Bans(ctx context.Context) ([]model.Ban, error) {
+	return b.repo.Bans(ctx)
+}
+
+// Unban снимает блокировку клиента на всех экземплярах
+func (b *PenaltyBox) Unban(ctx context.Context, key string) error {
+	if err := b.repo.Unban(ctx, key); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	delete(b.bans, key)
+	b.mu.Unlock()
+	return nil
+}
+
+// rejectBanned отвечает отказом заблокированному клиенту
+func rejectBanned(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(retryAfter)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{
+		"code":  "429",
+		"error": "Temporarily banned",
+	})
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+)
+
+func TestMiddlewarePenaltyBox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	box, err := NewPenaltyBox(repo, repo, RemoteIPExtractor(), config.BanConfig{
+		Threshold:   2,
+		Window:      time.Minute,
+		Duration:    time.Minute,
+		MaxDuration: 10 * time.Minute,
+	})
+	require.NoError(t, err)
+
+	limiter := NewLimiter(ctx, repo, nil, config.BucketConfig{Capacity: 1, RefilRate: 0, RefilTime: time.Hour})
+	handler := Middleware([]*Policy{NewDefaultPolicy(limiter, RemoteIPExtractor())}, nil, box, config.RateLimitConfig{})(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) }))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do().Code)
+	assert.Equal(t, http.StatusTooManyRequests, do().Code)
+	assert.Equal(t, http.StatusTooManyRequests, do().Code, "second violation bans the client")
+
+	banned := do()
+	assert.Equal(t, http.StatusTooManyRequests, banned.Code)
+	assert.Contains(t, banned.Body.String(), "Temporarily banned")
+	assert.Equal(t, "60", banned.Header().Get("Retry-After"))
+
+	bans, err := box.Bans(ctx)
+	require.NoError(t, err)
+	require.Len(t, bans, 1)
+	assert.Equal(t, "ip:10.0.0.1", bans[0].Key)
+
+	// нарушения во время блокировки ее не продлевают
+	ban, err := repo.Ban(ctx, "ip:10.0.0.1", time.Minute, 10*time.Minute, 10*time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ban.Strikes)
+	assert.Equal(t, bans[0].Until, ban.Until)
+
+	require.NoError(t, box.Unban(ctx, "ip:10.0.0.1"))
+	assert.Contains(t, do().Body.String(), "Rate limit exceeded")
+}
+
+func TestNewPenaltyBoxInvalid(t *testing.T) {
+	_, err := NewPenaltyBox(nil, nil, nil, config.BanConfig{Threshold: 1, Window: time.Minute, Duration: time.Hour, MaxDuration: time.Minute})
+	assert.ErrorIs(t, err, ErrInvalidBan)
+}
@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+)
+
+const defaultConcurrencyLeaseTTL = 30 * time.Second
+
+// ConcurrencyLimiter ограничивает количество одновременных запросов клиента.
+// Запрос занимает слот на время обработки и продлевает его каждые lease_ttl/2,
+// поэтому слоты экземпляра, завершившегося аварийно, освобождаются через lease_ttl
+type ConcurrencyLimiter struct {
+	repo         repository.ConcurrencyRepository
+	extractor    KeyExtractor
+	limit        int
+	leaseTTL     time.Duration
+	onStoreError string
+}
+
+// NewConcurrencyLimiter создает ограничитель одновременных запросов
+func NewConcurrencyLimiter(repo repository.ConcurrencyRepository, extractor KeyExtractor, cfg config.ConcurrencyConfig, onStoreError string) *ConcurrencyLimiter {
+	leaseTTL := cfg.LeaseTTL
+	if leaseTTL <= 0 {
+		leaseTTL = defaultConcurrencyLeaseTTL
+	}
+
+	return &ConcurrencyLimiter{
+		repo:         repo,
+		extractor:    FallbackExtractor(extractor, RemoteIPExtractor()),
+		limit:        cfg.MaxInFlight,
+		leaseTTL:     leaseTTL,
+		onStoreError: onStoreError,
+	}
+}
+
+// Middleware middleware для ограничения одновременных запросов
+func (c *ConcurrencyLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := c.extractor.Key(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		lease := newLeaseID()
+		acquired, inFlight, err := c.repo.AcquireSlot(r.Context(), key, lease, c.limit, c.leaseTTL)
+		if err != nil {
+			slog.Error("Failed to acquire concurrency slot", "key", logKey(key), "error", err)
+			if c.onStoreError == OnStoreErrorAllow {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rejectUnavailable(w)
+			return
+		}
+		if !acquired {
+			slog.Debug("Concurrency limit exceeded", "key", logKey(key), "in_flight", inFlight)
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{
+				"code":  "429",
+				"error": "Too many concurrent requests",
+			})
+			return
+		}
+
+		// слот освобождается и после отмены запроса клиентом
+		ctx := context.WithoutCancel(r.Context())
+		stop := c.keepAlive(ctx, key, lease)
+		defer func() {
+			stop()
+			if err := c.repo.ReleaseSlot(ctx, key, lease); err != nil {
+				slog.Error("Failed to release concurrency slot", "key", logKey(key), "error", err)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// keepAlive продлевает слот, пока запрос обрабатывается. Возвращает функцию остановки продления.
+// Если слот истек и его заняли другие запросы, продление прекращается: запрос дорабатывает сверх лимита
+// и не занимает слот повторно, когда он освободится
+func (c *ConcurrencyLimiter) keepAlive(ctx context.Context, key, lease string) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(c.leaseTTL / 2)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				acquired, inFlight, err := c.repo.AcquireSlot(ctx, key, lease, c.limit, c.leaseTTL)
+				if err != nil {
+					slog.Error("Failed to extend concurrency slot", "key", logKey(key), "error", err)
+					continue
+				}
+				if !acquired {
+					slog.Warn("Concurrency slot lost, request runs over the limit", "key", logKey(key), "in_flight", inFlight)
+					return
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// newLeaseID возвращает случайный идентификатор слота
+func newLeaseID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	limiter := NewConcurrencyLimiter(repo, RemoteIPExtractor(), config.ConcurrencyConfig{MaxInFlight: 1, LeaseTTL: time.Minute}, "")
+
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(started)
+			<-release
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- do("/slow") }()
+	<-started
+
+	assert.Equal(t, http.StatusTooManyRequests, do("/"), "slot is held by the slow request")
+
+	close(release)
+	require.Equal(t, http.StatusOK, <-done)
+	assert.Equal(t, http.StatusOK, do("/"), "slot is released after the response")
+}
+
+// lostSlotRepository отказывает в продлении слота, как если бы слот истек и его заняли другие запросы
+type lostSlotRepository struct {
+	repository.ConcurrencyRepository
+	calls atomic.Int32
+}
+
+func (r *lostSlotRepository) AcquireSlot(ctx context.Context, key string, lease string, limit int, ttl time.Duration) (bool, int, error) {
+	if r.calls.Add(1) > 1 {
+		return false, limit, nil
+	}
+	return r.ConcurrencyRepository.AcquireSlot(ctx, key, lease, limit, ttl)
+}
+
+func TestConcurrencySlotLost(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := &lostSlotRepository{ConcurrencyRepository: memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})}
+	limiter := NewConcurrencyLimiter(repo, RemoteIPExtractor(), config.ConcurrencyConfig{MaxInFlight: 1, LeaseTTL: 10 * time.Millisecond}, "")
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.EqualValues(t, 2, repo.calls.Load(), "lost slot is not renewed again")
+}
+
+func TestConcurrencySlotExpires(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	ok, _, err := repo.AcquireSlot(ctx, "k", "crashed", 1, time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	time.Sleep(5 * time.Millisecond)
+	ok, inFlight, err := repo.AcquireSlot(ctx, "k", "next", 1, time.Minute)
+	require.NoError(t, err)
+	assert.True(t, ok, "expired slot of a crashed instance is freed")
+	assert.Equal(t, 1, inFlight)
+}
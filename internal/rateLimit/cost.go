@@ -0,0 +1,89 @@
+package ratelimit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+// Costs стоимость запросов в единицах лимита: правила по маршрутам и стоимость, которую сообщает бэкенд
+type Costs struct {
+	rules  []costRule
+	header string
+}
+
+type costRule struct {
+	matcher *matcher
+	cost    int
+}
+
+// NewCosts создает стоимость запросов по конфигурации
+func NewCosts(cfg config.CostConfig) (*Costs, error) {
+	c := &Costs{header: http.CanonicalHeaderKey(cfg.Header)}
+
+	for i, rule := range cfg.Rules {
+		if rule.Cost <= 0 {
+			return nil, fmt.Errorf("%w: cost rule %d: cost must be positive", ErrInvalidPolicy, i)
+		}
+		m, err := newMatcher(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("cost rule %d: %w", i, err)
+		}
+		c.rules = append(c.rules, costRule{matcher: m, cost: rule.Cost})
+	}
+
+	return c, nil
+}
+
+// cost возвращает стоимость запроса по первому совпавшему правилу, по умолчанию 1
+func (c *Costs) cost(r *http.Request) int {
+	if c == nil {
+		return 1
+	}
+	for _, rule := range c.rules {
+		if rule.matcher.match(r) {
+			return rule.cost
+		}
+	}
+	return 1
+}
+
+// costRecorder читает и удаляет из ответа бэкенда заголовок со стоимостью запроса
+type costRecorder struct {
+	http.ResponseWriter
+	header      string
+	cost        int
+	wroteHeader bool
+}
+
+func (c *costRecorder) WriteHeader(status int) {
+	c.capture()
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *costRecorder) Write(b []byte) (int, error) {
+	c.capture()
+	return c.ResponseWriter.Write(b)
+}
+
+// capture запоминает стоимость из заголовка до отправки заголовков клиенту
+func (c *costRecorder) capture() {
+	if c.wroteHeader {
+		return
+	}
+	c.wroteHeader = true
+
+	if v := c.Header().Get(c.header); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			c.cost = n
+		}
+		c.Header().Del(c.header)
+	}
+}
+
+// Unwrap возвращает исходный ResponseWriter для http.ResponseController
+func (c *costRecorder) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
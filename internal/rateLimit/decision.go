@@ -0,0 +1,74 @@
+package ratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// Decision результат проверки лимита для клиента
+type Decision struct {
+	Policy     string // имя политики, принявшей решение
+	Allowed    bool
+	Limit      int           // емкость бакета
+	Remaining  int           // оставшееся количество токенов
+	Reset      time.Duration // время до полного заполнения бакета
+	RetryAfter time.Duration // время, через которое в бакете хватит токенов на запрос
+	Err        error         // ошибка хранилища, из-за которой решение не удалось принять
+
+	key string // ключ клиента в алгоритме политики
+}
+
+// newDecision формирует решение по состоянию бакета для запроса стоимостью cost токенов
+func newDecision(allowed bool, b *model.Bucket, cost int) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     b.Capacity,
+		Remaining: max(b.Tokens, 0),
+	}
+
+	if b.RefilRate > 0 {
+		d.Reset = refillDuration(b.Capacity-b.Tokens, b.RefilRate)
+		if !allowed {
+			d.RetryAfter = max(refillDuration(cost-b.Tokens, b.RefilRate), time.Second)
+		}
+	}
+
+	return d
+}
+
+// refillDuration возвращает время, за которое в бакет будет добавлено tokens токенов.
+// Пополнение идет с точностью до секунды, поэтому результат округляется вверх.
+func refillDuration(tokens, refilRate int) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	seconds := math.Ceil(float64(tokens) / float64(refilRate))
+	return time.Duration(seconds) * time.Second
+}
+
+// setHeaders выставляет заголовки RateLimit-* (draft-ietf-httpapi-ratelimit-headers)
+func setHeaders(w http.ResponseWriter, d Decision) {
+	if d.Limit <= 0 {
+		return
+	}
+	w.Header().Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	w.Header().Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	w.Header().Set("RateLimit-Reset", strconv.Itoa(seconds(d.Reset)))
+}
+
+// setRetryAfter выставляет заголовок Retry-After для отклоненного запроса
+func setRetryAfter(w http.ResponseWriter, d Decision) {
+	if d.RetryAfter <= 0 {
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(d.RetryAfter)))
+}
+
+// seconds переводит длительность в целое число секунд с округлением вверх
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+const (
+	defaultHybridBatch    = 10
+	defaultHybridLeaseTTL = time.Second
+)
+
+// HybridLimiter двухуровневый лимитер: токены берутся из общего хранилища партиями
+// и расходуются локально, неиспользованные токены возвращаются по истечении аренды.
+// Каждый экземпляр балансировщика может пропустить сверх лимита не больше batch запросов на ключ,
+// зато обращается к хранилищу один раз на batch запросов.
+type HybridLimiter struct {
+	limiter  *Limiter
+	batch    int
+	leaseTTL time.Duration
+
+	mu     sync.Mutex
+	leases map[string]*lease
+}
+
+// lease токены, арендованные у хранилища для одного ключа
+type lease struct {
+	mu      sync.Mutex
+	tokens  int
+	expires time.Time
+	bucket  model.Bucket // состояние бакета в хранилище на момент аренды
+	removed bool
+}
+
+// NewHybridLimiter создает двухуровневый лимитер поверх limiter и запускает возврат
+// неиспользованных токенов. При остановке ctx все арендованные токены возвращаются в хранилище
+func NewHybridLimiter(ctx context.Context, limiter *Limiter, cfg config.HybridConfig) *HybridLimiter {
+	h := &HybridLimiter{
+		limiter:  limiter,
+		batch:    cfg.Batch,
+		leaseTTL: cfg.LeaseTTL,
+		leases:   make(map[string]*lease),
+	}
+	if h.batch <= 0 {
+		h.batch = defaultHybridBatch
+	}
+	if h.leaseTTL <= 0 {
+		h.leaseTTL = defaultHybridLeaseTTL
+	}
+
+	h.startReleaseLeases(ctx)
+
+	return h
+}
+
+// Allow проверяет, может ли клиент выполнить запрос стоимостью cost, расходуя локально арендованные токены
+func (h *HybridLimiter) Allow(ctx context.Context, key string, cost int) Decision {
+	if h.limiter.unlimited(key) {
+		return Decision{Allowed: true}
+	}
+
+	var d Decision
+	h.withLease(key, func(le *lease) {
+		d = h.allow(ctx, key, le, cost, time.Now())
+	})
+	return d
+}
+
+// Charge списывает n токенов после обработки запроса: сначала из аренды, остаток из хранилища
+func (h *HybridLimiter) Charge(ctx context.Context, key string, n int) error {
+	if h.limiter.unlimited(key) {
+		return nil
+	}
+
+	h.withLease(key, func(le *lease) {
+		local := min(le.tokens, n)
+		le.tokens -= local
+		n -= local
+	})
+	if n == 0 {
+		return nil
+	}
+	return h.limiter.Charge(ctx, key, n)
+}
+
+// withLease выполняет fn с заблокированной арендой ключа
+func (h *HybridLimiter) withLease(key string, fn func(le *lease)) {
+	for {
+		le := h.lease(key)
+		le.mu.Lock()
+		if le.removed {
+			// аренду вернули в хранилище, пока мы ждали блокировку
+			le.mu.Unlock()
+			continue
+		}
+		fn(le)
+		le.mu.Unlock()
+		return
+	}
+}
+
+func (h *HybridLimiter) allow(ctx context.Context, key string, le *lease, cost int, now time.Time) Decision {
+	if le.tokens < cost || !now.Before(le.expires) {
+		if err := h.renew(ctx, key, le, max(h.batch, cost), now); err != nil {
+			return Decision{Err: err}
+		}
+	}
+
+	b := le.bucket
+	b.Tokens += le.tokens
+	cost = min(cost, b.Capacity)
+	if le.tokens < cost {
+		slog.Debug("No tokens available", "key", logKey(key))
+		return newDecision(false, &b, cost)
+	}
+
+	le.tokens -= cost
+	b.Tokens -= cost
+	return newDecision(true, &b, cost)
+}
+
+// renew возвращает остаток аренды и арендует новую партию из batch токенов
+func (h *HybridLimiter) renew(ctx context.Context, key string, le *lease, batch int, now time.Time) error {
+	if le.tokens > 0 {
+		if err := h.limiter.bucketRepo.Release(ctx, key, le.tokens); err != nil {
+			slog.Error("Failed to release tokens", "key", logKey(key), "error", err)
+			return err
+		}
+		le.tokens = 0
+	}
+
+	granted, b, err := h.limiter.bucketRepo.Acquire(ctx, key, batch)
+	if errors.Is(err, repository.ErrBucketNotFound) {
+		nb := h.limiter.newBucket(key)
+		granted = max(0, min(batch, nb.Tokens))
+		nb.Tokens -= granted
+
+		slog.Debug("Creating new bucket", "key", logKey(key))
+		err = h.limiter.bucketRepo.CreateBucket(ctx, key, nb.Capacity, nb.RefilRate, nb.Tokens)
+		b = &nb
+	}
+	if err != nil {
+		slog.Error("Failed to acquire tokens", "key", logKey(key), "error", err)
+		return err
+	}
+
+	le.tokens, le.bucket, le.expires = granted, *b, now.Add(h.leaseTTL)
+	return nil
+}
+
+// lease возвращает аренду ключа, создавая ее при необходимости
+func (h *HybridLimiter) lease(key string) *lease {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	le, ok := h.leases[key]
+	if !ok {
+		le = &lease{}
+		h.leases[key] = le
+	}
+	return le
+}
+
+// startReleaseLeases периодически возвращает в хранилище остатки истекших аренд
+func (h *HybridLimiter) startReleaseLeases(ctx context.Context) {
+	ticker := time.NewTicker(h.leaseTTL)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				// ctx уже отменен, поэтому токены возвращаются с отдельным контекстом
+				h.releaseLeases(context.WithoutCancel(ctx), time.Time{})
+				return
+			case now := <-ticker.C:
+				h.releaseLeases(ctx, now)
+			}
+		}
+	}()
+}
+
+// releaseLeases возвращает в хранилище токены аренд, истекших к моменту now.
+// Нулевое now возвращает все аренды
+func (h *HybridLimiter) releaseLeases(ctx context.Context, now time.Time) {
+	h.mu.Lock()
+	leases := make(map[string]*lease, len(h.leases))
+	for key, le := range h.leases {
+		leases[key] = le
+	}
+	h.mu.Unlock()
+
+	for key, le := range leases {
+		le.mu.Lock()
+		if !now.IsZero() && now.Before(le.expires) {
+			le.mu.Unlock()
+			continue
+		}
+		if le.tokens > 0 {
+			if err := h.limiter.bucketRepo.Release(ctx, key, le.tokens); err != nil {
+				slog.Error("Failed to release tokens", "key", logKey(key), "error", err)
+			}
+			le.tokens = 0
+		}
+		le.removed = true
+		le.mu.Unlock()
+
+		h.mu.Lock()
+		if h.leases[key] == le {
+			delete(h.leases, key)
+		}
+		h.mu.Unlock()
+	}
+}
@@ -0,0 +1,325 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/clientip"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+var (
+	// ErrUnknownKeyExtractor ошибка, если тип извлекателя ключа не поддерживается
+	ErrUnknownKeyExtractor = errors.New("unknown key extractor type")
+	// ErrInvalidKeyExtractor ошибка, если конфигурация извлекателя ключа некорректна
+	ErrInvalidKeyExtractor = errors.New("invalid key extractor config")
+)
+
+// KeyExtractor извлекает из запроса ключ клиента, по которому ведется бакет
+type KeyExtractor interface {
+	// Key возвращает ключ клиента и false, если ключ в запросе отсутствует
+	Key(r *http.Request) (string, bool)
+}
+
+// KeyExtractorFunc адаптер для использования функции в качестве KeyExtractor
+type KeyExtractorFunc func(r *http.Request) (string, bool)
+
+// Key вызывает f(r)
+func (f KeyExtractorFunc) Key(r *http.Request) (string, bool) {
+	return f(r)
+}
+
+// NewKeyExtractor создает извлекатель ключа по конфигурации
+func NewKeyExtractor(cfg config.KeyExtractorConfig) (KeyExtractor, error) {
+	var (
+		extractor KeyExtractor
+		err       error
+	)
+
+	switch cfg.Type {
+	case "", "remote_ip":
+		extractor = RemoteIPExtractor()
+	case "header":
+		extractor, err = HeaderExtractor(cfg.Name)
+	case "cookie":
+		extractor, err = CookieExtractor(cfg.Name)
+	case "jwt_claim":
+		extractor, err = JWTClaimExtractor(cfg.Name, cfg.Header, cfg.Secret)
+	case "path":
+		extractor, err = PathExtractor(cfg.Template)
+	case "composite":
+		extractor, err = compositeFromConfig(cfg.Parts)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKeyExtractor, cfg.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Fallback != nil {
+		fallback, err := NewKeyExtractor(*cfg.Fallback)
+		if err != nil {
+			return nil, fmt.Errorf("fallback: %w", err)
+		}
+		extractor = FallbackExtractor(extractor, fallback)
+	}
+
+	return extractor, nil
+}
+
+func compositeFromConfig(parts []config.KeyExtractorConfig) (KeyExtractor, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%w: composite requires parts", ErrInvalidKeyExtractor)
+	}
+	extractors := make([]KeyExtractor, 0, len(parts))
+	for i, part := range parts {
+		e, err := NewKeyExtractor(part)
+		if err != nil {
+			return nil, fmt.Errorf("part %d: %w", i, err)
+		}
+		extractors = append(extractors, e)
+	}
+	return CompositeExtractor(extractors...), nil
+}
+
+// RemoteIPExtractor использует в качестве ключа IP адрес клиента, определенный clientip.Middleware
+func RemoteIPExtractor() KeyExtractor {
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		ip := clientip.FromRequest(r)
+		if ip == "" {
+			return "", false
+		}
+		return "ip:" + ip, true
+	})
+}
+
+// HeaderExtractor использует в качестве ключа значение заголовка name
+func HeaderExtractor(name string) (KeyExtractor, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: header requires name", ErrInvalidKeyExtractor)
+	}
+	prefix := "header:" + strings.ToLower(name) + ":"
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		value := r.Header.Get(name)
+		if value == "" {
+			return "", false
+		}
+		return prefix + value, true
+	}), nil
+}
+
+// CookieExtractor использует в качестве ключа значение cookie name
+func CookieExtractor(name string) (KeyExtractor, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: cookie requires name", ErrInvalidKeyExtractor)
+	}
+	prefix := "cookie:" + name + ":"
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		c, err := r.Cookie(name)
+		if err != nil || c.Value == "" {
+			return "", false
+		}
+		return prefix + c.Value, true
+	}), nil
+}
+
+// JWTClaimExtractor использует в качестве ключа claim из JWT токена.
+// Токен берется из заголовка header (по умолчанию Authorization, схема Bearer).
+// Если задан secret, подпись токена (HS256, HS384, HS512) и срок действия проверяются,
+// иначе claim читается без проверки.
+func JWTClaimExtractor(claim, header, secret string) (KeyExtractor, error) {
+	if claim == "" {
+		return nil, fmt.Errorf("%w: jwt_claim requires name", ErrInvalidKeyExtractor)
+	}
+	if header == "" {
+		header = "Authorization"
+	}
+	prefix := "jwt:" + claim + ":"
+
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		token := r.Header.Get(header)
+		if scheme, rest, ok := strings.Cut(token, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			token = rest
+		}
+		if token == "" {
+			return "", false
+		}
+
+		claims, err := parseJWT(token, []byte(secret))
+		if err != nil {
+			return "", false
+		}
+
+		value, ok := claims[claim]
+		if !ok || value == nil {
+			return "", false
+		}
+		return prefix + fmt.Sprint(value), true
+	}), nil
+}
+
+// parseJWT разбирает JWT токен и возвращает claims. Подпись проверяется, только если secret не пустой
+func parseJWT(token string, secret []byte) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode payload: %w", err)
+	}
+	var claims map[string]interface{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("unmarshal payload: %w", err)
+	}
+
+	if len(secret) == 0 {
+		return claims, nil
+	}
+
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("decode header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, fmt.Errorf("unmarshal header: %w", err)
+	}
+
+	var newHash func() hash.Hash
+	switch header.Alg {
+	case "HS256":
+		newHash = sha256.New
+	case "HS384":
+		newHash = sha512.New384
+	case "HS512":
+		newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported alg %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+	mac := hmac.New(newHash, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("invalid signature")
+	}
+
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() > int64(exp) {
+		return nil, errors.New("token expired")
+	}
+
+	return claims, nil
+}
+
+// PathExtractor использует в качестве ключа значения параметров из шаблона пути,
+// например для шаблона /tenants/{tenant}/ и пути /tenants/acme/orders ключом будет acme.
+// Шаблон сопоставляется с началом пути.
+func PathExtractor(template string) (KeyExtractor, error) {
+	segments := strings.Split(strings.Trim(template, "/"), "/")
+	params := 0
+	for _, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			params++
+		}
+	}
+	if params == 0 {
+		return nil, fmt.Errorf("%w: path template %q has no parameters", ErrInvalidKeyExtractor, template)
+	}
+
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(path) < len(segments) {
+			return "", false
+		}
+
+		values := make([]string, 0, params)
+		for i, s := range segments {
+			if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+				if path[i] == "" {
+					return "", false
+				}
+				values = append(values, path[i])
+				continue
+			}
+			if s != path[i] {
+				return "", false
+			}
+		}
+		return "path:" + strings.Join(values, "/"), true
+	}), nil
+}
+
+// CompositeExtractor объединяет ключи нескольких извлекателей.
+// Ключ считается найденным, только если найдены ключи всех извлекателей.
+func CompositeExtractor(extractors ...KeyExtractor) KeyExtractor {
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		keys := make([]string, 0, len(extractors))
+		for _, e := range extractors {
+			key, ok := e.Key(r)
+			if !ok {
+				return "", false
+			}
+			keys = append(keys, key)
+		}
+		return strings.Join(keys, "|"), true
+	})
+}
+
+// FallbackExtractor использует fallback, если основной извлекатель не нашел ключ
+func FallbackExtractor(primary, fallback KeyExtractor) KeyExtractor {
+	return KeyExtractorFunc(func(r *http.Request) (string, bool) {
+		if key, ok := primary.Key(r); ok {
+			return key, true
+		}
+		return fallback.Key(r)
+	})
+}
+
+// logKey возвращает ключ клиента для записи в лог. Значения, заданные клиентом
+// (заголовки, cookie, claims, сегменты пути), заменяются коротким хешем, IP адреса остаются как есть
+func logKey(key string) string {
+	if rest, ok := strings.CutPrefix(key, "policy:"); ok {
+		// ключ именованной политики: policy:<имя>:<ключ клиента>
+		if name, clientKey, ok := strings.Cut(rest, ":"); ok {
+			return "policy:" + name + ":" + logKey(clientKey)
+		}
+	}
+
+	parts := strings.Split(key, "|")
+	for i, part := range parts {
+		// префикс ключа: ip:, path: или header:<имя>:, cookie:<имя>:, jwt:<claim>:
+		n := 3
+		switch {
+		case strings.HasPrefix(part, "ip:"):
+			continue
+		case strings.HasPrefix(part, "path:"):
+			n = 2
+		}
+		fields := strings.SplitN(part, ":", n)
+		if len(fields) < n {
+			fields = []string{part}
+		}
+		value := fields[len(fields)-1]
+		sum := sha256.Sum256([]byte(value))
+		fields[len(fields)-1] = "sha256:" + hex.EncodeToString(sum[:6])
+		parts[i] = strings.Join(fields, ":")
+	}
+	return strings.Join(parts, "|")
+}
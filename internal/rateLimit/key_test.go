@@ -0,0 +1,136 @@
+package ratelimit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+func signHS256(t *testing.T, payload, secret string) string {
+	t.Helper()
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewKeyExtractor(t *testing.T) {
+	token := signHS256(t, `{"sub":"user-1"}`, "secret")
+
+	tests := []struct {
+		name    string
+		cfg     config.KeyExtractorConfig
+		prepare func(r *http.Request)
+		want    string
+		wantOK  bool
+	}{
+		{
+			name:   "remote ip by default",
+			cfg:    config.KeyExtractorConfig{},
+			want:   "ip:10.0.0.1",
+			wantOK: true,
+		},
+		{
+			name:    "header",
+			cfg:     config.KeyExtractorConfig{Type: "header", Name: "X-API-Key"},
+			prepare: func(r *http.Request) { r.Header.Set("X-API-Key", "abc") },
+			want:    "header:x-api-key:abc",
+			wantOK:  true,
+		},
+		{
+			name: "header missing falls back to ip",
+			cfg: config.KeyExtractorConfig{
+				Type:     "header",
+				Name:     "X-API-Key",
+				Fallback: &config.KeyExtractorConfig{Type: "remote_ip"},
+			},
+			want:   "ip:10.0.0.1",
+			wantOK: true,
+		},
+		{
+			name:    "cookie",
+			cfg:     config.KeyExtractorConfig{Type: "cookie", Name: "session"},
+			prepare: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "session", Value: "s1"}) },
+			want:    "cookie:session:s1",
+			wantOK:  true,
+		},
+		{
+			name:    "jwt claim with valid signature",
+			cfg:     config.KeyExtractorConfig{Type: "jwt_claim", Name: "sub", Secret: "secret"},
+			prepare: func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+			want:    "jwt:sub:user-1",
+			wantOK:  true,
+		},
+		{
+			name:    "jwt claim with invalid signature",
+			cfg:     config.KeyExtractorConfig{Type: "jwt_claim", Name: "sub", Secret: "other"},
+			prepare: func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+		},
+		{
+			name:    "jwt claim without verification",
+			cfg:     config.KeyExtractorConfig{Type: "jwt_claim", Name: "sub"},
+			prepare: func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) },
+			want:    "jwt:sub:user-1",
+			wantOK:  true,
+		},
+		{
+			name:   "path template",
+			cfg:    config.KeyExtractorConfig{Type: "path", Template: "/tenants/{tenant}/"},
+			want:   "path:acme",
+			wantOK: true,
+		},
+		{
+			name: "composite",
+			cfg: config.KeyExtractorConfig{Type: "composite", Parts: []config.KeyExtractorConfig{
+				{Type: "path", Template: "/tenants/{tenant}"},
+				{Type: "remote_ip"},
+			}},
+			want:   "path:acme|ip:10.0.0.1",
+			wantOK: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := NewKeyExtractor(tt.cfg)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodGet, "/tenants/acme/orders", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			if tt.prepare != nil {
+				tt.prepare(req)
+			}
+
+			key, ok := extractor.Key(req)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, key)
+		})
+	}
+}
+
+func TestNewKeyExtractorInvalid(t *testing.T) {
+	_, err := NewKeyExtractor(config.KeyExtractorConfig{Type: "unknown"})
+	assert.ErrorIs(t, err, ErrUnknownKeyExtractor)
+
+	_, err = NewKeyExtractor(config.KeyExtractorConfig{Type: "header"})
+	assert.ErrorIs(t, err, ErrInvalidKeyExtractor)
+
+	_, err = NewKeyExtractor(config.KeyExtractorConfig{Type: "path", Template: "/static"})
+	assert.ErrorIs(t, err, ErrInvalidKeyExtractor)
+}
+
+func TestLogKey(t *testing.T) {
+	key := logKey("header:x-api-key:secret:value|ip:10.0.0.1")
+	assert.Regexp(t, `^header:x-api-key:sha256:[0-9a-f]{12}\|ip:10\.0\.0\.1$`, key)
+	assert.NotContains(t, key, "secret")
+	assert.Regexp(t, `^path:sha256:[0-9a-f]{12}$`, logKey("path:acme/orders"))
+	assert.Equal(t, "policy:login:ip:10.0.0.1", logKey("policy:login:ip:10.0.0.1"))
+}
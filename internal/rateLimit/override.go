@@ -0,0 +1,138 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// defaultOverridesSyncInterval период синхронизации переопределений, если он не задан в конфигурации
+const defaultOverridesSyncInterval = 10 * time.Second
+
+var (
+	// ErrInvalidOverride ошибка, если переопределение лимитов некорректно
+	ErrInvalidOverride = errors.New("invalid override")
+	// ErrOverridesDisabled ошибка, если репозиторий переопределений не задан
+	ErrOverridesDisabled = errors.New("overrides are disabled")
+)
+
+// StartSyncOverrides периодически загружает переопределения лимитов из репозитория,
+// чтобы изменения, сделанные через другие экземпляры балансировщика, применялись без перезапуска
+func (l *Limiter) StartSyncOverrides(ctx context.Context, interval time.Duration) {
+	if l.overrideRepo == nil {
+		return
+	}
+
+	if interval <= 0 {
+		interval = defaultOverridesSyncInterval
+	}
+
+	if err := l.syncOverrides(ctx); err != nil {
+		slog.Error("Failed to load overrides", "error", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := l.syncOverrides(ctx); err != nil {
+					slog.Error("Failed to sync overrides", "error", err)
+				}
+			}
+		}
+	}()
+}
+
+// syncOverrides заменяет локальную копию переопределений данными из репозитория
+func (l *Limiter) syncOverrides(ctx context.Context) error {
+	overrides, err := l.overrideRepo.Overrides(ctx)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]model.Override, len(overrides))
+	for _, o := range overrides {
+		m[o.Key] = o
+	}
+
+	l.overridesMu.Lock()
+	l.overrides = m
+	l.overridesMu.Unlock()
+	return nil
+}
+
+// override возвращает переопределение лимитов для ключа из локальной копии
+func (l *Limiter) override(key string) (model.Override, bool) {
+	l.overridesMu.RLock()
+	defer l.overridesMu.RUnlock()
+	o, ok := l.overrides[key]
+	return o, ok
+}
+
+// Overrides возвращает все переопределения лимитов
+func (l *Limiter) Overrides(ctx context.Context) ([]model.Override, error) {
+	if l.overrideRepo == nil {
+		return nil, ErrOverridesDisabled
+	}
+	return l.overrideRepo.Overrides(ctx)
+}
+
+// Override возвращает переопределение лимитов для ключа
+func (l *Limiter) Override(ctx context.Context, key string) (*model.Override, error) {
+	if l.overrideRepo == nil {
+		return nil, ErrOverridesDisabled
+	}
+	return l.overrideRepo.Override(ctx, key)
+}
+
+// SetOverride сохраняет переопределение лимитов и применяет его к существующему бакету
+func (l *Limiter) SetOverride(ctx context.Context, o model.Override) error {
+	if l.overrideRepo == nil {
+		return ErrOverridesDisabled
+	}
+	if o.Key == "" {
+		return fmt.Errorf("%w: key is required", ErrInvalidOverride)
+	}
+	if !o.Unlimited && (o.Capacity <= 0 || o.RefilRate < 0) {
+		return fmt.Errorf("%w: capacity must be positive and refil_rate non-negative", ErrInvalidOverride)
+	}
+
+	if err := l.overrideRepo.SetOverride(ctx, o); err != nil {
+		return err
+	}
+
+	l.overridesMu.Lock()
+	l.overrides[o.Key] = o
+	l.overridesMu.Unlock()
+
+	if o.Unlimited {
+		return nil
+	}
+	return l.bucketRepo.UpdateBucketLimits(ctx, o.Key, o.Capacity, o.RefilRate)
+}
+
+// DeleteOverride удаляет переопределение лимитов и возвращает бакету лимиты по умолчанию
+func (l *Limiter) DeleteOverride(ctx context.Context, key string) error {
+	if l.overrideRepo == nil {
+		return ErrOverridesDisabled
+	}
+	if err := l.overrideRepo.DeleteOverride(ctx, key); err != nil {
+		return err
+	}
+
+	l.overridesMu.Lock()
+	delete(l.overrides, key)
+	l.overridesMu.Unlock()
+
+	cfg := l.config()
+	return l.bucketRepo.UpdateBucketLimits(ctx, key, cfg.Capacity, cfg.RefilRate)
+}
@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+func TestOverrides(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	limiter := newLimiter(repo, repo, config.BucketConfig{Capacity: 1, RefilRate: 1, RefilTime: time.Hour})
+
+	// бакет с лимитами по умолчанию получает лимиты переопределения
+	assert.True(t, limiter.Allow(ctx, "ip:10.0.0.1", 1).Allowed)
+	assert.False(t, limiter.Allow(ctx, "ip:10.0.0.1", 1).Allowed)
+	require.NoError(t, limiter.SetOverride(ctx, model.Override{Key: "ip:10.0.0.1", Capacity: 5, RefilRate: 2}))
+	b, err := repo.Bucket(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 5, b.Capacity)
+	assert.Equal(t, 2, b.RefilRate)
+
+	// новый бакет с переопределением создается заполненным
+	require.NoError(t, limiter.SetOverride(ctx, model.Override{Key: "ip:10.0.0.2", Capacity: 3, RefilRate: 1}))
+	d := limiter.Allow(ctx, "ip:10.0.0.2", 1)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 3, d.Limit)
+	assert.Equal(t, 2, d.Remaining)
+
+	require.NoError(t, limiter.SetOverride(ctx, model.Override{Key: "ip:10.0.0.3", Unlimited: true}))
+	for range 10 {
+		assert.True(t, limiter.Allow(ctx, "ip:10.0.0.3", 1).Allowed)
+	}
+
+	assert.ErrorIs(t, limiter.SetOverride(ctx, model.Override{Key: "ip:10.0.0.4"}), ErrInvalidOverride)
+	assert.ErrorIs(t, limiter.SetOverride(ctx, model.Override{Capacity: 1}), ErrInvalidOverride)
+
+	require.NoError(t, limiter.DeleteOverride(ctx, "ip:10.0.0.1"))
+	b, err = repo.Bucket(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, b.Capacity)
+
+	disabled := newLimiter(repo, nil, config.BucketConfig{})
+	assert.ErrorIs(t, disabled.SetOverride(ctx, model.Override{Key: "ip:10.0.0.1", Capacity: 1}), ErrOverridesDisabled)
+	assert.ErrorIs(t, disabled.DeleteOverride(ctx, "ip:10.0.0.1"), ErrOverridesDisabled)
+}
+
+func TestStartSyncOverrides(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+	require.NoError(t, repo.SetOverride(ctx, model.Override{Key: "ip:10.0.0.1", Unlimited: true}))
+
+	limiter := newLimiter(repo, repo, config.BucketConfig{Capacity: 1, Tokens: new(int), RefilRate: 1, RefilTime: time.Hour})
+	limiter.StartSyncOverrides(ctx, 10*time.Millisecond)
+	assert.True(t, limiter.Allow(ctx, "ip:10.0.0.1", 1).Allowed)
+
+	// переопределение, сделанное другим экземпляром, применяется после синхронизации
+	require.NoError(t, repo.DeleteOverride(ctx, "ip:10.0.0.1"))
+	assert.Eventually(t, func() bool {
+		return !limiter.Allow(ctx, "ip:10.0.0.1", 1).Allowed
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,258 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+)
+
+const (
+	// DefaultPolicyName имя политики по умолчанию, которая применяется ко всем запросам
+	DefaultPolicyName = "default"
+	// policyKeyPrefix префикс ключей бакетов именованных политик: policy:<имя>:<ключ клиента>
+	policyKeyPrefix = "policy:"
+
+	// PolicyModeEnforce политика отклоняет запросы сверх лимита
+	PolicyModeEnforce = "enforce"
+	// PolicyModeShadow политика только записывает решения и пропускает все запросы
+	PolicyModeShadow = "shadow"
+)
+
+var (
+	// ErrInvalidPolicy ошибка, если конфигурация политики некорректна
+	ErrInvalidPolicy = errors.New("invalid rate limit policy")
+)
+
+// Algorithm алгоритм ограничения количества запросов
+type Algorithm interface {
+	// Allow проверяет запрос стоимостью cost
+	Allow(ctx context.Context, key string, cost int) Decision
+	// Charge списывает n единиц лимита после обработки запроса, даже если лимит исчерпан
+	Charge(ctx context.Context, key string, n int) error
+}
+
+// Policy политика ограничения запросов: какие запросы она затрагивает,
+// как определяется клиент и какой алгоритм применяется
+type Policy struct {
+	name      string
+	prefix    string
+	shadow    bool
+	matcher   *matcher
+	extractor KeyExtractor
+	algorithm Algorithm
+
+	shadowDenied atomic.Uint64 // количество запросов, которые политика отклонила бы в режиме shadow
+}
+
+// NewDefaultPolicy создает политику по умолчанию, которая применяется ко всем запросам.
+// Ключи бакетов политики по умолчанию не содержат префикса, поэтому к ним применяются переопределения лимитов
+func NewDefaultPolicy(algorithm Algorithm, extractor KeyExtractor) *Policy {
+	return &Policy{
+		name:      DefaultPolicyName,
+		matcher:   &matcher{},
+		extractor: FallbackExtractor(extractor, RemoteIPExtractor()),
+		algorithm: algorithm,
+	}
+}
+
+// NewPolicies создает политики по конфигурации в заданном порядке.
+// Если hybrid.enabled, бакеты токенов политик расходуются через двухуровневый лимитер
+func NewPolicies(ctx context.Context, cfgs []config.PolicyConfig, bucketRepo repository.BucketRepository, windowRepo repository.WindowRepository, hybrid config.HybridConfig) ([]*Policy, error) {
+	policies := make([]*Policy, 0, len(cfgs))
+	names := make(map[string]struct{}, len(cfgs))
+
+	for i, cfg := range cfgs {
+		if cfg.Name == "" || cfg.Name == DefaultPolicyName {
+			return nil, fmt.Errorf("%w: policy %d: name is required and must not be %q", ErrInvalidPolicy, i, DefaultPolicyName)
+		}
+		if _, ok := names[cfg.Name]; ok {
+			return nil, fmt.Errorf("%w: duplicate policy name %q", ErrInvalidPolicy, cfg.Name)
+		}
+		names[cfg.Name] = struct{}{}
+
+		policy, err := newPolicy(ctx, cfg, bucketRepo, windowRepo, hybrid)
+		if err != nil {
+			return nil, fmt.Errorf("policy %q: %w", cfg.Name, err)
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+func newPolicy(ctx context.Context, cfg config.PolicyConfig, bucketRepo repository.BucketRepository, windowRepo repository.WindowRepository, hybrid config.HybridConfig) (*Policy, error) {
+	m, err := newMatcher(cfg.Match)
+	if err != nil {
+		return nil, err
+	}
+
+	extractor, err := NewKeyExtractor(cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	var shadow bool
+	switch cfg.Mode {
+	case "", PolicyModeEnforce:
+	case PolicyModeShadow:
+		shadow = true
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidPolicy, cfg.Mode)
+	}
+
+	var algorithm Algorithm
+	switch cfg.Algorithm {
+	case "", "token_bucket":
+		if cfg.Bucket.Capacity <= 0 || cfg.Bucket.RefilRate < 0 {
+			return nil, fmt.Errorf("%w: token_bucket requires positive bucket.capacity", ErrInvalidPolicy)
+		}
+		// бакеты всех политик пополняются общей горутиной лимитера по умолчанию
+		limiter := newLimiter(bucketRepo, nil, cfg.Bucket)
+		algorithm = limiter
+		if hybrid.Enabled {
+			algorithm = NewHybridLimiter(ctx, limiter, hybrid)
+		}
+	case "fixed_window":
+		if cfg.Limit <= 0 || cfg.Window <= 0 {
+			return nil, fmt.Errorf("%w: fixed_window requires positive limit and window", ErrInvalidPolicy)
+		}
+		algorithm = NewWindowLimiter(windowRepo, cfg.Limit, cfg.Window)
+	default:
+		return nil, fmt.Errorf("%w: unknown algorithm %q", ErrInvalidPolicy, cfg.Algorithm)
+	}
+
+	return &Policy{
+		name:      cfg.Name,
+		prefix:    policyKeyPrefix + cfg.Name + ":",
+		shadow:    shadow,
+		matcher:   m,
+		extractor: FallbackExtractor(extractor, RemoteIPExtractor()),
+		algorithm: algorithm,
+	}, nil
+}
+
+// Name возвращает имя политики
+func (p *Policy) Name() string {
+	return p.name
+}
+
+// Mode возвращает режим политики: enforce или shadow
+func (p *Policy) Mode() string {
+	if p.shadow {
+		return PolicyModeShadow
+	}
+	return PolicyModeEnforce
+}
+
+// ShadowDenied возвращает количество запросов, которые политика в режиме shadow отклонила бы
+func (p *Policy) ShadowDenied() uint64 {
+	return p.shadowDenied.Load()
+}
+
+// Check проверяет запрос стоимостью cost политикой. Возвращает false, если политика к запросу не применяется
+// или в запросе нет ключа клиента для нее
+func (p *Policy) Check(r *http.Request, cost int) (Decision, bool) {
+	if !p.matcher.match(r) {
+		return Decision{}, false
+	}
+
+	key, ok := p.extractor.Key(r)
+	if !ok {
+		slog.Debug("Rate limit key not found, policy skipped", "policy", p.name)
+		return Decision{}, false
+	}
+
+	d := p.algorithm.Allow(r.Context(), p.prefix+key, cost)
+	d.Policy = p.name
+	d.key = p.prefix + key
+	return d, true
+}
+
+// Charge списывает n единиц лимита клиента, запрос которого политика разрешила решением d
+func (p *Policy) Charge(ctx context.Context, d Decision, n int) error {
+	if d.key == "" {
+		return nil
+	}
+	return p.algorithm.Charge(ctx, d.key, n)
+}
+
+// matcher определяет, применяется ли политика к запросу. Пустые условия совпадают с любым запросом
+type matcher struct {
+	pathPrefix string
+	pathRegex  *regexp.Regexp
+	methods    map[string]struct{}
+	hosts      []string
+}
+
+func newMatcher(cfg config.MatchConfig) (*matcher, error) {
+	m := &matcher{pathPrefix: cfg.PathPrefix}
+
+	if cfg.PathRegex != "" {
+		re, err := regexp.Compile(cfg.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("%w: path_regex: %v", ErrInvalidPolicy, err)
+		}
+		m.pathRegex = re
+	}
+
+	if len(cfg.Methods) > 0 {
+		m.methods = make(map[string]struct{}, len(cfg.Methods))
+		for _, method := range cfg.Methods {
+			m.methods[strings.ToUpper(method)] = struct{}{}
+		}
+	}
+
+	for _, host := range cfg.Hosts {
+		m.hosts = append(m.hosts, strings.ToLower(host))
+	}
+
+	return m, nil
+}
+
+func (m *matcher) match(r *http.Request) bool {
+	if m.pathPrefix != "" && !strings.HasPrefix(r.URL.Path, m.pathPrefix) {
+		return false
+	}
+	if m.pathRegex != nil && !m.pathRegex.MatchString(r.URL.Path) {
+		return false
+	}
+	if m.methods != nil {
+		if _, ok := m.methods[r.Method]; !ok {
+			return false
+		}
+	}
+	if len(m.hosts) > 0 && !m.matchHost(r.Host) {
+		return false
+	}
+	return true
+}
+
+// matchHost сравнивает хост запроса без порта с хостами политики, поддерживается маска *.example.com
+func (m *matcher) matchHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, pattern := range m.hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+			if strings.HasSuffix(host, suffix) {
+				return true
+			}
+			continue
+		}
+		if host == pattern {
+			return true
+		}
+	}
+	return false
+}
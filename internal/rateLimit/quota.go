@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+const (
+	// QuotaPeriodDay квота на календарные сутки
+	QuotaPeriodDay = "day"
+	// QuotaPeriodMonth квота на календарный месяц
+	QuotaPeriodMonth = "month"
+)
+
+var (
+	// ErrInvalidQuota ошибка, если конфигурация квот некорректна
+	ErrInvalidQuota = errors.New("invalid quota")
+)
+
+// QuotaUsage использование квоты клиентом за текущий период
+type QuotaUsage struct {
+	Period    string    `json:"period"`
+	Limit     int64     `json:"limit"`
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// QuotaLimiter ограничивает количество запросов клиента за календарные сутки и месяцы.
+// Границы периодов считаются в заданном часовом поясе
+type QuotaLimiter struct {
+	repo         repository.QuotaRepository
+	extractor    KeyExtractor
+	location     *time.Location
+	status       int
+	limits       []config.QuotaLimitConfig
+	onStoreError string
+}
+
+// NewQuotaLimiter создает ограничитель квот
+func NewQuotaLimiter(repo repository.QuotaRepository, extractor KeyExtractor, cfg config.QuotaConfig, onStoreError string) (*QuotaLimiter, error) {
+	location := time.UTC
+	if cfg.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(cfg.Timezone); err != nil {
+			return nil, fmt.Errorf("%w: timezone: %v", ErrInvalidQuota, err)
+		}
+	}
+
+	status := cfg.Status
+	switch status {
+	case 0:
+		status = http.StatusTooManyRequests
+	case http.StatusTooManyRequests, http.StatusForbidden:
+	default:
+		return nil, fmt.Errorf("%w: status must be 429 or 403", ErrInvalidQuota)
+	}
+
+	periods := make(map[string]struct{}, len(cfg.Limits))
+	for _, limit := range cfg.Limits {
+		if limit.Period != QuotaPeriodDay && limit.Period != QuotaPeriodMonth {
+			return nil, fmt.Errorf("%w: unknown period %q", ErrInvalidQuota, limit.Period)
+		}
+		if _, ok := periods[limit.Period]; ok {
+			return nil, fmt.Errorf("%w: duplicate period %q", ErrInvalidQuota, limit.Period)
+		}
+		if limit.Limit <= 0 {
+			return nil, fmt.Errorf("%w: %s limit must be positive", ErrInvalidQuota, limit.Period)
+		}
+		periods[limit.Period] = struct{}{}
+	}
+
+	return &QuotaLimiter{
+		repo:         repo,
+		extractor:    FallbackExtractor(extractor, RemoteIPExtractor()),
+		location:     location,
+		status:       status,
+		limits:       cfg.Limits,
+		onStoreError: onStoreError,
+	}, nil
+}
+
+// periods возвращает текущие периоды квот на момент now
+func (q *QuotaLimiter) periods(now time.Time) []model.QuotaPeriod {
+	now = now.In(q.location)
+	periods := make([]model.QuotaPeriod, len(q.limits))
+
+	for i, limit := range q.limits {
+		var (
+			start, reset time.Time
+			layout       string
+		)
+		switch limit.Period {
+		case QuotaPeriodDay:
+			start = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, q.location)
+			reset, layout = start.AddDate(0, 0, 1), time.DateOnly
+		case QuotaPeriodMonth:
+			start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, q.location)
+			reset, layout = start.AddDate(0, 1, 0), "2006-01"
+		}
+		periods[i] = model.QuotaPeriod{
+			ID:    limit.Period + ":" + start.Format(layout),
+			Limit: limit.Limit,
+			Reset: reset,
+		}
+	}
+
+	return periods
+}
+
+// usage формирует использование квот по значениям счетчиков
+func (q *QuotaLimiter) usage(periods []model.QuotaPeriod, counts []int64) []QuotaUsage {
+	usage := make([]QuotaUsage, len(periods))
+	for i, period := range periods {
+		usage[i] = QuotaUsage{
+			Period:    q.limits[i].Period,
+			Limit:     period.Limit,
+			Used:      counts[i],
+			Remaining: max(period.Limit-counts[i], 0),
+			Reset:     period.Reset,
+		}
+	}
+	return usage
+}
+
+// Usage возвращает использование квот клиентом за текущие периоды
+func (q *QuotaLimiter) Usage(ctx context.Context, key string) ([]QuotaUsage, error) {
+	periods := q.periods(time.Now())
+	counts, err := q.repo.QuotaUsage(ctx, key, periods)
+	if err != nil {
+		return nil, err
+	}
+	return q.usage(periods, counts), nil
+}
+
+// ResetUsage обнуляет использование квот клиентом за текущие периоды
+func (q *QuotaLimiter) ResetUsage(ctx context.Context, key string) error {
+	return q.repo.ResetQuota(ctx, key, q.periods(time.Now()))
+}
+
+// Middleware middleware для ограничения запросов квотами.
+// Отклоненные запросы в квоте не учитываются
+func (q *QuotaLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, ok := q.extractor.Key(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		now := time.Now()
+		periods := q.periods(now)
+		allowed, counts, err := q.repo.ConsumeQuota(r.Context(), key, periods)
+		if err != nil {
+			slog.Error("Failed to consume quota", "key", logKey(key), "error", err)
+			if q.onStoreError == OnStoreErrorAllow {
+				next.ServeHTTP(w, r)
+				return
+			}
+			rejectUnavailable(w)
+			return
+		}
+
+		usage := q.usage(periods, counts)
+		strictest := usage[0]
+		for _, u := range usage[1:] {
+			if u.Remaining < strictest.Remaining {
+				strictest = u
+			}
+		}
+		setQuotaHeaders(w, strictest, now)
+
+		if !allowed {
+			slog.Debug("Quota exceeded", "key", logKey(key), "period", strictest.Period)
+			q.reject(w, strictest, now)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// reject отвечает ошибкой исчерпания квоты
+func (q *QuotaLimiter) reject(w http.ResponseWriter, u QuotaUsage, now time.Time) {
+	body := map[string]string{
+		"code":  strconv.Itoa(q.status),
+		"error": "Quota exceeded",
+	}
+	if u.Period != "" {
+		body["period"] = u.Period
+		body["reset"] = u.Reset.Format(time.RFC3339)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds(u.Reset.Sub(now))))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(q.status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// setQuotaHeaders устанавливает заголовки X-Quota-* по квоте с наименьшим остатком
+func setQuotaHeaders(w http.ResponseWriter, u QuotaUsage, now time.Time) {
+	w.Header().Set("X-Quota-Period", u.Period)
+	w.Header().Set("X-Quota-Limit", strconv.FormatInt(u.Limit, 10))
+	w.Header().Set("X-Quota-Remaining", strconv.FormatInt(u.Remaining, 10))
+	w.Header().Set("X-Quota-Reset", strconv.Itoa(seconds(u.Reset.Sub(now))))
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+)
+
+func TestQuotaPeriods(t *testing.T) {
+	q, err := NewQuotaLimiter(nil, RemoteIPExtractor(), config.QuotaConfig{
+		Timezone: "Europe/Moscow",
+		Limits:   []config.QuotaLimitConfig{{Period: "day", Limit: 10}, {Period: "month", Limit: 100}},
+	}, "")
+	require.NoError(t, err)
+
+	// 22:30 UTC 31 января - уже 1 февраля по Москве
+	periods := q.periods(time.Date(2024, time.January, 31, 22, 30, 0, 0, time.UTC))
+	require.Len(t, periods, 2)
+	assert.Equal(t, "day:2024-02-01", periods[0].ID)
+	assert.Equal(t, time.Date(2024, time.February, 1, 21, 0, 0, 0, time.UTC), periods[0].Reset.UTC())
+	assert.Equal(t, "month:2024-02", periods[1].ID)
+	assert.Equal(t, time.Date(2024, time.February, 29, 21, 0, 0, 0, time.UTC), periods[1].Reset.UTC())
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q, err := NewQuotaLimiter(memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{}), RemoteIPExtractor(), config.QuotaConfig{
+		Status: http.StatusForbidden,
+		Limits: []config.QuotaLimitConfig{{Period: "month", Limit: 5}, {Period: "day", Limit: 2}},
+	}, "")
+	require.NoError(t, err)
+
+	handler := q.Middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do()
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "day", first.Header().Get("X-Quota-Period"))
+	assert.Equal(t, "2", first.Header().Get("X-Quota-Limit"))
+	assert.Equal(t, "1", first.Header().Get("X-Quota-Remaining"))
+
+	assert.Equal(t, http.StatusOK, do().Code)
+	denied := do()
+	assert.Equal(t, http.StatusForbidden, denied.Code)
+	assert.Contains(t, denied.Body.String(), `"error":"Quota exceeded"`)
+	assert.NotEmpty(t, denied.Header().Get("Retry-After"))
+
+	usage, err := q.Usage(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), usage[0].Used, "denied requests are not counted")
+
+	require.NoError(t, q.ResetUsage(ctx, "ip:10.0.0.1"))
+	assert.Equal(t, http.StatusOK, do().Code)
+}
@@ -4,36 +4,76 @@ package ratelimit
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
-	"net"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/metrics"
 	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
 )
 
+const (
+	// OnStoreErrorAllow пропускать запросы, если хранилище недоступно
+	OnStoreErrorAllow = "allow"
+	// OnStoreErrorDeny отклонять запросы с кодом 503, если хранилище недоступно
+	OnStoreErrorDeny = "deny"
+	// OnStoreErrorLocal ограничивать запросы локально в памяти процесса, пока хранилище недоступно
+	OnStoreErrorLocal = "local"
+
+	// StorageRedis хранить лимиты в Redis, общем для всех экземпляров балансировщика
+	StorageRedis = "redis"
+	// StorageMemory хранить лимиты в памяти процесса
+	StorageMemory = "memory"
+)
+
+// penaltyBoxPolicy имя политики в метриках для запросов заблокированных клиентов
+const penaltyBoxPolicy = "penalty_box"
+
 // Limiter структура для ограничения количества запросов
 type Limiter struct {
 	bucketRepo   repository.BucketRepository
+	overrideRepo repository.OverrideRepository
+
+	configMu     sync.RWMutex
 	bucketConfig config.BucketConfig
+	refillTicker *time.Ticker
+
+	overridesMu sync.RWMutex
+	overrides   map[string]model.Override
 }
 
-// NewLimiter создает новый лимитер
-func NewLimiter(ctx context.Context, bucketRepo repository.BucketRepository, bucketConfig config.BucketConfig) *Limiter {
-	limiter := &Limiter{
-		bucketRepo:   bucketRepo,
-		bucketConfig: bucketConfig,
-	}
+// NewLimiter создает новый лимитер и запускает пополнение бакетов.
+// overrideRepo может быть nil, тогда переопределения лимитов не используются
+func NewLimiter(ctx context.Context, bucketRepo repository.BucketRepository, overrideRepo repository.OverrideRepository, bucketConfig config.BucketConfig) *Limiter {
+	limiter := newLimiter(bucketRepo, overrideRepo, bucketConfig)
 
 	limiter.StartRefillBuckets(ctx)
 
 	return limiter
 }
 
+// newLimiter создает новый лимитер без запуска пополнения бакетов
+func newLimiter(bucketRepo repository.BucketRepository, overrideRepo repository.OverrideRepository, bucketConfig config.BucketConfig) *Limiter {
+	return &Limiter{
+		bucketRepo:   bucketRepo,
+		overrideRepo: overrideRepo,
+		bucketConfig: bucketConfig,
+		overrides:    make(map[string]model.Override),
+	}
+}
+
 // StartRefillBuckets заполняет бакеты токенами
 func (l *Limiter) StartRefillBuckets(ctx context.Context) {
+	l.configMu.Lock()
 	ticker := time.NewTicker(l.bucketConfig.RefilTime)
+	l.refillTicker = ticker
+	l.configMu.Unlock()
 
 	go func() {
 		defer ticker.Stop()
@@ -54,65 +94,253 @@ func (l *Limiter) StartRefillBuckets(ctx context.Context) {
 	}()
 }
 
-// Allow проверяет, может ли клиент выполнить запрос
-func (l *Limiter) Allow(ctx context.Context, clientIP string) bool {
-	b, err := l.bucketRepo.Bucket(ctx, clientIP)
+// UpdateConfig применяет новые лимиты по умолчанию к лимитеру и существующим бакетам.
+// Бакеты с переопределенными лимитами и бакеты именованных политик не меняются.
+// Аренды токенов HybridLimiter, взятые до изменения, действуют до истечения lease_ttl
+func (l *Limiter) UpdateConfig(ctx context.Context, cfg config.BucketConfig) error {
+	l.configMu.Lock()
+	old := l.bucketConfig
+	if l.refillTicker != nil && cfg.RefilTime != old.RefilTime {
+		l.refillTicker.Reset(cfg.RefilTime)
+	}
+	l.bucketConfig = cfg
+	l.configMu.Unlock()
+
+	if cfg.Capacity == old.Capacity && cfg.RefilRate == old.RefilRate {
+		return nil
+	}
+	return l.SyncBucketLimits(ctx)
+}
+
+// SyncBucketLimits устанавливает текущие лимиты по умолчанию всем бакетам в хранилище,
+// кроме бакетов с переопределенными лимитами и бакетов именованных политик
+func (l *Limiter) SyncBucketLimits(ctx context.Context) error {
+	cfg := l.config()
+	err := l.bucketRepo.UpdateAllBucketLimits(ctx, cfg.Capacity, cfg.RefilRate, func(key string) bool {
+		_, overridden := l.override(key)
+		return overridden || strings.HasPrefix(key, policyKeyPrefix)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update bucket limits: %w", err)
+	}
+	return nil
+}
+
+// config возвращает текущие лимиты по умолчанию
+func (l *Limiter) config() config.BucketConfig {
+	l.configMu.RLock()
+	defer l.configMu.RUnlock()
+	return l.bucketConfig
+}
+
+// Allow проверяет, может ли клиент выполнить запрос стоимостью cost токенов, и возвращает состояние его бакета.
+// Стоимость больше емкости бакета уменьшается до емкости, иначе запрос не прошел бы никогда
+func (l *Limiter) Allow(ctx context.Context, key string, cost int) Decision {
+	if l.unlimited(key) {
+		return Decision{Allowed: true}
+	}
+
+	b, err := l.bucketRepo.Bucket(ctx, key)
 	if err == nil {
+		cost = min(cost, b.Capacity)
 		if b.Tokens <= 0 {
-			slog.Debug("No tokens available", "ip", clientIP)
-			return false
+			slog.Debug("No tokens available", "key", logKey(key))
+			return newDecision(false, b, cost)
 		}
-		ok, err := l.bucketRepo.Decrease(ctx, clientIP)
+		ok, b, err := l.bucketRepo.Decrease(ctx, key, cost)
 		if err != nil {
-			slog.Error("Failed to decrease tokens", "ip", clientIP, "error", err)
-			return false
+			slog.Error("Failed to decrease tokens", "key", logKey(key), "error", err)
+			return Decision{Err: err}
 		}
 		if !ok {
-			slog.Debug("Failed to decrease tokens", "ip", clientIP)
-			return false
+			slog.Debug("Failed to decrease tokens", "key", logKey(key))
 		}
-		return true
+		return newDecision(ok, b, cost)
 	}
 
 	if err.Error() != repository.ErrBucketNotFound.Error() {
-		slog.Error("Failed to get bucket", "ip", clientIP, "error", err)
-		return false
+		slog.Error("Failed to get bucket", "key", logKey(key), "error", err)
+		return Decision{Err: err}
+	}
+
+	nb := l.newBucket(key)
+	cost = min(cost, nb.Capacity)
+	allowed := nb.Tokens >= cost
+	if allowed {
+		nb.Tokens -= cost
 	}
 
-	slog.Debug("Creating new bucket", "ip", clientIP)
-	err = l.bucketRepo.CreateBucket(ctx, clientIP, l.bucketConfig.Capacity, l.bucketConfig.RefilRate, l.bucketConfig.Tokens-1)
+	slog.Debug("Creating new bucket", "key", logKey(key))
+	err = l.bucketRepo.CreateBucket(ctx, key, nb.Capacity, nb.RefilRate, nb.Tokens)
 	if err != nil {
-		slog.Error("Failed to create bucket", "ip", clientIP, "error", err)
-		return false
+		slog.Error("Failed to create bucket", "key", logKey(key), "error", err)
+		return Decision{Err: err}
 	}
 
-	return true
+	return newDecision(allowed, &nb, cost)
 }
 
-// Middleware middleware для ограничения количества запросов
-func Middleware(limiter *Limiter) func(http.Handler) http.Handler {
+// Charge списывает n токенов после обработки запроса, даже если их не хватает.
+// Бакет уходит в минус, и следующие запросы клиента отклоняются, пока он не пополнится
+func (l *Limiter) Charge(ctx context.Context, key string, n int) error {
+	if l.unlimited(key) {
+		return nil
+	}
+
+	_, err := l.bucketRepo.Charge(ctx, key, n)
+	if errors.Is(err, repository.ErrBucketNotFound) {
+		nb := l.newBucket(key)
+		err = l.bucketRepo.CreateBucket(ctx, key, nb.Capacity, nb.RefilRate, nb.Tokens-n)
+	}
+	if err != nil {
+		slog.Error("Failed to charge tokens", "key", logKey(key), "error", err)
+	}
+	return err
+}
+
+// newBucket возвращает параметры нового бакета с учетом переопределения лимитов для ключа
+func (l *Limiter) newBucket(key string) model.Bucket {
+	if o, ok := l.override(key); ok && !o.Unlimited {
+		// бакет с переопределенными лимитами создается заполненным
+		return model.Bucket{Tokens: o.Capacity, Capacity: o.Capacity, RefilRate: o.RefilRate}
+	}
+	cfg := l.config()
+	return model.Bucket{
+		Tokens:    cfg.InitialTokens(),
+		Capacity:  cfg.Capacity,
+		RefilRate: cfg.RefilRate,
+	}
+}
+
+// unlimited проверяет, снято ли ограничение для ключа переопределением
+func (l *Limiter) unlimited(key string) bool {
+	o, ok := l.override(key)
+	return ok && o.Unlimited
+}
+
+// Middleware middleware для ограничения количества запросов.
+// Запрос проверяется по порядку всеми политиками, которые к нему применяются, и пропускается,
+// только если все они его разрешили. Токены, списанные политиками до отказа, не возвращаются.
+// Запрос стоит столько токенов, сколько задают costs. Если бэкенд сообщил в ответе большую стоимость,
+// разница списывается всеми разрешившими запрос политиками после ответа. costs может быть nil.
+// Политики в режиме shadow проверяют и учитывают запрос, но не отклоняют его и не влияют на заголовки RateLimit-*.
+// Запросы клиентов, заблокированных box, отклоняются без проверки политик, box может быть nil
+func Middleware(policies []*Policy, costs *Costs, box *PenaltyBox, cfg config.RateLimitConfig) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			slog.Debug("Rate limit middleware", "remote_addr", r.RemoteAddr)
 
-			ip, _, err := net.SplitHostPort(r.RemoteAddr)
-			if err != nil {
-				slog.Error("Failed to parse remote address", "error", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
-				return
+			var banKey string
+			if box != nil {
+				banKey, _ = box.extractor.Key(r)
+				if retryAfter, banned := box.banned(banKey, time.Now()); banned {
+					slog.Debug("Client is banned", "key", logKey(banKey))
+					metrics.RateLimitDecision(penaltyBoxPolicy, metrics.DecisionRejected)
+					rejectBanned(w, retryAfter)
+					return
+				}
 			}
 
-			if !limiter.Allow(r.Context(), ip) {
-				w.Header().Set("Content-Type", "application/json")
-				w.WriteHeader(http.StatusTooManyRequests)
-				json.NewEncoder(w).Encode(map[string]string{
-					"code":  "429",
-					"error": "Rate limit exceeded",
-				})
+			var (
+				strictest Decision
+				matched   bool
+				charged   = make(map[*Policy]Decision, len(policies))
+				shadowed  []string
+			)
+			cost := costs.cost(r)
+			for _, policy := range policies {
+				decision, ok := policy.Check(r, cost)
+				if !ok {
+					continue
+				}
+				metrics.RateLimitDecision(policy.name, decisionLabel(decision, policy.shadow))
+				if decision.Err != nil && (policy.shadow || cfg.OnStoreError == OnStoreErrorAllow) {
+					continue
+				}
+
+				if policy.shadow {
+					if !decision.Allowed {
+						policy.shadowDenied.Add(1)
+						shadowed = append(shadowed, policy.name)
+						slog.Info("Rate limit exceeded in shadow mode", "policy", policy.name, "key", logKey(decision.key))
+					}
+					charged[policy] = decision
+					continue
+				}
+
+				if decision.Err != nil {
+					rejectUnavailable(w)
+					return
+				}
+
+				if !decision.Allowed {
+					slog.Debug("Rate limit exceeded", "policy", decision.Policy, "remote_addr", r.RemoteAddr)
+					if box != nil && banKey != "" {
+						box.violation(r.Context(), banKey)
+					}
+					setHeaders(w, decision)
+					setRetryAfter(w, decision)
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusTooManyRequests)
+					json.NewEncoder(w).Encode(map[string]string{
+						"code":  "429",
+						"error": "Rate limit exceeded",
+					})
+					return
+				}
+
+				charged[policy] = decision
+				if decision.Limit > 0 && (!matched || decision.Remaining < strictest.Remaining) {
+					strictest, matched = decision, true
+				}
+			}
+
+			if cfg.Headers && matched {
+				setHeaders(w, strictest)
+			}
+			if cfg.ShadowHeader && len(shadowed) > 0 {
+				w.Header().Set("X-RateLimit-Shadow", strings.Join(shadowed, ", "))
+			}
+
+			if costs == nil || costs.header == "" {
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			next.ServeHTTP(w, r)
+			rec := &costRecorder{ResponseWriter: w, header: costs.header}
+			next.ServeHTTP(rec, r)
+
+			if extra := rec.cost - cost; extra > 0 {
+				ctx := context.WithoutCancel(r.Context())
+				for policy, decision := range charged {
+					policy.Charge(ctx, decision, extra)
+				}
+			}
 		})
 	}
 }
+
+// rejectUnavailable отвечает 503, если хранилище лимитов недоступно и запросы при этом отклоняются
+func rejectUnavailable(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(map[string]string{
+		"code":  "503",
+		"error": "Rate limit store unavailable",
+	})
+}
+
+// decisionLabel возвращает значение метки решения политики
+func decisionLabel(d Decision, shadow bool) string {
+	switch {
+	case d.Err != nil:
+		return metrics.DecisionError
+	case d.Allowed:
+		return metrics.DecisionAllowed
+	case shadow:
+		return metrics.DecisionShadowRejected
+	default:
+		return metrics.DecisionRejected
+	}
+}
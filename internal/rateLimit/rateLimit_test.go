@@ -0,0 +1,404 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// stubRepository простой репозиторий бакетов в памяти без пополнения
+type stubRepository struct {
+	buckets map[string]*model.Bucket
+}
+
+func newStubRepository() *stubRepository {
+	return &stubRepository{buckets: make(map[string]*model.Bucket)}
+}
+
+func (s *stubRepository) CreateBucket(_ context.Context, key string, capacity int, refilRate int, tokens int) error {
+	s.buckets[key] = &model.Bucket{Tokens: tokens, Capacity: capacity, RefilRate: refilRate, LastRefill: time.Now()}
+	return nil
+}
+
+func (s *stubRepository) Bucket(_ context.Context, key string) (*model.Bucket, error) {
+	b, ok := s.buckets[key]
+	if !ok {
+		return nil, repository.ErrBucketNotFound
+	}
+	copied := *b
+	return &copied, nil
+}
+
+func (s *stubRepository) Decrease(_ context.Context, key string, cost int) (bool, *model.Bucket, error) {
+	b, ok := s.buckets[key]
+	if !ok {
+		return false, nil, repository.ErrBucketNotFound
+	}
+	allowed := b.Tokens >= cost
+	if allowed {
+		b.Tokens -= cost
+	}
+	copied := *b
+	return allowed, &copied, nil
+}
+
+func (s *stubRepository) Charge(_ context.Context, key string, n int) (*model.Bucket, error) {
+	b, ok := s.buckets[key]
+	if !ok {
+		return nil, repository.ErrBucketNotFound
+	}
+	b.Tokens -= n
+	copied := *b
+	return &copied, nil
+}
+
+func (s *stubRepository) RefillAllBuckets(_ context.Context) error {
+	return nil
+}
+
+func (s *stubRepository) Acquire(_ context.Context, key string, n int) (int, *model.Bucket, error) {
+	b, ok := s.buckets[key]
+	if !ok {
+		return 0, nil, repository.ErrBucketNotFound
+	}
+	granted := max(0, min(b.Tokens, n))
+	b.Tokens -= granted
+	copied := *b
+	return granted, &copied, nil
+}
+
+func (s *stubRepository) Release(_ context.Context, key string, n int) error {
+	if b, ok := s.buckets[key]; ok {
+		b.Tokens = min(b.Capacity, b.Tokens+n)
+	}
+	return nil
+}
+
+func (s *stubRepository) UpdateBucketLimits(_ context.Context, key string, capacity int, refilRate int) error {
+	if b, ok := s.buckets[key]; ok {
+		b.Capacity, b.RefilRate, b.Tokens = capacity, refilRate, min(b.Tokens, capacity)
+	}
+	return nil
+}
+
+func (s *stubRepository) UpdateAllBucketLimits(ctx context.Context, capacity int, refilRate int, skip func(key string) bool) error {
+	for key := range s.buckets {
+		if !skip(key) {
+			s.UpdateBucketLimits(ctx, key, capacity, refilRate)
+		}
+	}
+	return nil
+}
+
+// stubWindowRepository счетчики фиксированного окна в памяти без сброса
+type stubWindowRepository struct {
+	counts map[string]int
+}
+
+func (s *stubWindowRepository) Increment(_ context.Context, key string, n int, window time.Duration) (int, time.Duration, error) {
+	s.counts[key] += n
+	return s.counts[key], window, nil
+}
+
+func TestMiddlewarePolicies(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	bucketRepo := newStubRepository()
+	policies, err := NewPolicies(ctx, []config.PolicyConfig{
+		{
+			Name:      "login",
+			Match:     config.MatchConfig{PathPrefix: "/login", Methods: []string{"post"}},
+			Algorithm: "fixed_window",
+			Limit:     1,
+			Window:    time.Minute,
+		},
+	}, bucketRepo, &stubWindowRepository{counts: make(map[string]int)}, config.HybridConfig{})
+	require.NoError(t, err)
+
+	limiter := NewLimiter(ctx, bucketRepo, nil, config.BucketConfig{Capacity: 10, RefilRate: 1, RefilTime: time.Hour})
+	policies = append(policies, NewDefaultPolicy(limiter, RemoteIPExtractor()))
+	handler := Middleware(policies, nil, nil, config.RateLimitConfig{})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/login").Code)
+	limited := do(http.MethodPost, "/login")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "60", limited.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/login").Code, "policy matches only POST")
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/other").Code)
+
+	// разрешенные запросы расходуют и лимит по умолчанию, отклоненный политикой - нет
+	b, err := bucketRepo.Bucket(ctx, "ip:10.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, 7, b.Tokens)
+}
+
+func TestMiddlewarePolicyMissingKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	policies, err := NewPolicies(ctx, []config.PolicyConfig{
+		{
+			Name:      "api",
+			Algorithm: "fixed_window",
+			Key:       config.KeyExtractorConfig{Type: "header", Name: "X-API-Key"},
+			Limit:     1,
+			Window:    time.Minute,
+		},
+	}, newStubRepository(), &stubWindowRepository{counts: make(map[string]int)}, config.HybridConfig{})
+	require.NoError(t, err)
+
+	handler := Middleware(policies, nil, nil, config.RateLimitConfig{})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(apiKey string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "" // без IP клиента не срабатывает и запасной ключ remote_ip
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// запросы без ключа политика пропускает, не считая
+	assert.Equal(t, http.StatusOK, do(""))
+	assert.Equal(t, http.StatusOK, do(""))
+	assert.Equal(t, http.StatusOK, do("abc"))
+	assert.Equal(t, http.StatusTooManyRequests, do("abc"))
+}
+
+func TestMiddlewareShadow(t *testing.T) {
+	ctx := context.Background()
+	policies, err := NewPolicies(ctx, []config.PolicyConfig{
+		{
+			Name:      "login",
+			Match:     config.MatchConfig{PathPrefix: "/login"},
+			Algorithm: "fixed_window",
+			Mode:      PolicyModeShadow,
+			Limit:     1,
+			Window:    time.Minute,
+		},
+	}, newStubRepository(), &stubWindowRepository{counts: make(map[string]int)}, config.HybridConfig{})
+	require.NoError(t, err)
+
+	handler := Middleware(policies, nil, nil, config.RateLimitConfig{ShadowHeader: true})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/login", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do()
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get("X-RateLimit-Shadow"))
+
+	second := do()
+	assert.Equal(t, http.StatusOK, second.Code, "shadow policy does not reject")
+	assert.Equal(t, "login", second.Header().Get("X-RateLimit-Shadow"))
+	assert.Equal(t, PolicyModeShadow, policies[0].Mode())
+	assert.Equal(t, uint64(1), policies[0].ShadowDenied())
+}
+
+func TestHybridLimiter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := newStubRepository()
+	limiter := newLimiter(repo, nil, config.BucketConfig{Capacity: 5, RefilRate: 1})
+	hybrid := NewHybridLimiter(ctx, limiter, config.HybridConfig{Batch: 3, LeaseTTL: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		d := hybrid.Allow(ctx, "k", 1)
+		require.True(t, d.Allowed, "request %d", i)
+		assert.Equal(t, 4-i, d.Remaining)
+	}
+	assert.False(t, hybrid.Allow(ctx, "k", 1).Allowed)
+	assert.Equal(t, 0, repo.buckets["k"].Tokens)
+
+	// неиспользованные токены возвращаются в хранилище
+	repo.buckets["k"].Tokens = 0
+	hybrid.leases["k"].tokens = 2
+	hybrid.releaseLeases(ctx, time.Time{})
+	assert.Equal(t, 2, repo.buckets["k"].Tokens)
+	assert.Empty(t, hybrid.leases)
+}
+
+func TestMiddlewareCost(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	repo := newStubRepository()
+	limiter := NewLimiter(ctx, repo, nil, config.BucketConfig{Capacity: 10, RefilRate: 1, RefilTime: time.Hour})
+	costs, err := NewCosts(config.CostConfig{
+		Header: "X-RateLimit-Cost",
+		Rules: []config.CostRuleConfig{
+			{Match: config.MatchConfig{PathPrefix: "/export"}, Cost: 3},
+			{Match: config.MatchConfig{PathPrefix: "/bulk"}, Cost: 5},
+			{Match: config.MatchConfig{PathPrefix: "/huge"}, Cost: 20},
+		},
+	})
+	require.NoError(t, err)
+
+	handler := Middleware([]*Policy{NewDefaultPolicy(limiter, RemoteIPExtractor())}, costs, nil, config.RateLimitConfig{})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/report" {
+				w.Header().Set("X-RateLimit-Cost", "5")
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+	do := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, do("/export").Code)
+	assert.Equal(t, 7, repo.buckets["ip:10.0.0.1"].Tokens)
+
+	report := do("/report")
+	assert.Equal(t, http.StatusOK, report.Code)
+	assert.Empty(t, report.Header().Get("X-RateLimit-Cost"), "cost header is not sent to the client")
+	assert.Equal(t, 2, repo.buckets["ip:10.0.0.1"].Tokens, "backend cost is charged after the response")
+
+	// Retry-After учитывает стоимость запроса: до 5 токенов не хватает 3, пополнение 1 токен в секунду
+	export := do("/export")
+	assert.Equal(t, http.StatusTooManyRequests, export.Code)
+	assert.Equal(t, "1", export.Header().Get("Retry-After"))
+	bulk := do("/bulk")
+	assert.Equal(t, http.StatusTooManyRequests, bulk.Code)
+	assert.Equal(t, "3", bulk.Header().Get("Retry-After"))
+
+	// стоимость больше емкости уменьшается до емкости, и запрос проходит с полным бакетом
+	huge := do("/huge")
+	assert.Equal(t, http.StatusTooManyRequests, huge.Code)
+	assert.Equal(t, "8", huge.Header().Get("Retry-After"))
+	repo.buckets["ip:10.0.0.1"].Tokens = 10
+	assert.Equal(t, http.StatusOK, do("/huge").Code)
+	assert.Equal(t, 0, repo.buckets["ip:10.0.0.1"].Tokens)
+
+	repo.buckets["ip:10.0.0.1"].Tokens = 2
+	assert.Equal(t, http.StatusOK, do("/").Code)
+}
+
+func TestNewPoliciesInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PolicyConfig
+	}{
+		{name: "missing name", cfg: config.PolicyConfig{Limit: 1, Window: time.Second, Algorithm: "fixed_window"}},
+		{name: "unknown algorithm", cfg: config.PolicyConfig{Name: "p", Algorithm: "leaky"}},
+		{name: "empty window", cfg: config.PolicyConfig{Name: "p", Algorithm: "fixed_window", Limit: 1}},
+		{name: "empty bucket", cfg: config.PolicyConfig{Name: "p"}},
+		{name: "bad regex", cfg: config.PolicyConfig{Name: "p", Match: config.MatchConfig{PathRegex: "("}, Bucket: config.BucketConfig{Capacity: 1}}},
+		{name: "unknown mode", cfg: config.PolicyConfig{Name: "p", Mode: "dry", Bucket: config.BucketConfig{Capacity: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPolicies(context.Background(), []config.PolicyConfig{tt.cfg}, newStubRepository(), nil, config.HybridConfig{})
+			assert.ErrorIs(t, err, ErrInvalidPolicy)
+		})
+	}
+}
+
+func TestMiddlewareHeaders(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	limiter := NewLimiter(ctx, newStubRepository(), nil, config.BucketConfig{
+		Capacity:  2,
+		RefilRate: 1,
+		RefilTime: time.Hour,
+	})
+	policies := []*Policy{NewDefaultPolicy(limiter, RemoteIPExtractor())}
+	handler := Middleware(policies, nil, nil, config.RateLimitConfig{Headers: true})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		status     int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{name: "first request creates bucket", status: http.StatusOK, remaining: "1", reset: "1"},
+		{name: "last token", status: http.StatusOK, remaining: "0", reset: "2"},
+		{name: "limited", status: http.StatusTooManyRequests, remaining: "0", reset: "2", retryAfter: "1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+			assert.Equal(t, tt.remaining, rec.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, tt.reset, rec.Header().Get("RateLimit-Reset"))
+			assert.Equal(t, tt.retryAfter, rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+// unavailableRepository репозиторий бакетов, хранилище которого недоступно
+type unavailableRepository struct {
+	*stubRepository
+}
+
+func (unavailableRepository) Bucket(context.Context, string) (*model.Bucket, error) {
+	return nil, repository.ErrStoreUnavailable
+}
+
+func TestMiddlewareStoreError(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	limiter := NewLimiter(ctx, unavailableRepository{newStubRepository()}, nil, config.BucketConfig{Capacity: 10, RefilRate: 1, RefilTime: time.Hour})
+	policies := []*Policy{NewDefaultPolicy(limiter, RemoteIPExtractor())}
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for onStoreError, want := range map[string]int{
+		OnStoreErrorDeny:  http.StatusServiceUnavailable,
+		OnStoreErrorAllow: http.StatusOK,
+	} {
+		handler := Middleware(policies, nil, nil, config.RateLimitConfig{Headers: true, OnStoreError: onStoreError})(next)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		assert.Equal(t, want, rec.Code, onStoreError)
+		assert.Empty(t, rec.Header().Get("RateLimit-Limit"), onStoreError)
+	}
+}
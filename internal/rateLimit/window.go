@@ -0,0 +1,55 @@
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/repository"
+)
+
+// WindowLimiter ограничивает количество запросов в фиксированном окне времени
+type WindowLimiter struct {
+	windowRepo repository.WindowRepository
+	limit      int
+	window     time.Duration
+}
+
+// NewWindowLimiter создает новый лимитер фиксированного окна: не более limit запросов за window
+func NewWindowLimiter(windowRepo repository.WindowRepository, limit int, window time.Duration) *WindowLimiter {
+	return &WindowLimiter{
+		windowRepo: windowRepo,
+		limit:      limit,
+		window:     window,
+	}
+}
+
+// Allow проверяет, может ли клиент выполнить запрос стоимостью cost в текущем окне
+func (l *WindowLimiter) Allow(ctx context.Context, key string, cost int) Decision {
+	// стоимость больше лимита окна уменьшается до лимита, иначе запрос не прошел бы никогда
+	count, ttl, err := l.windowRepo.Increment(ctx, key, min(cost, l.limit), l.window)
+	if err != nil {
+		slog.Error("Failed to increment window", "key", logKey(key), "error", err)
+		return Decision{Err: err}
+	}
+
+	d := Decision{
+		Allowed:   count <= l.limit,
+		Limit:     l.limit,
+		Remaining: max(l.limit-count, 0),
+		Reset:     ttl,
+	}
+	if !d.Allowed {
+		d.RetryAfter = max(ttl.Round(time.Second), time.Second)
+	}
+	return d
+}
+
+// Charge учитывает в текущем окне еще n единиц после обработки запроса
+func (l *WindowLimiter) Charge(ctx context.Context, key string, n int) error {
+	if _, _, err := l.windowRepo.Increment(ctx, key, n, l.window); err != nil {
+		slog.Error("Failed to charge window", "key", logKey(key), "error", err)
+		return err
+	}
+	return nil
+}
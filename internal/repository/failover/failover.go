@@ -0,0 +1,441 @@
+// Package failover предоставляет обертки над репозиториями, которые переключаются
+// на резервное хранилище, пока основное хранилище недоступно
+package failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// isStoreError проверяет, что ошибка вызвана недоступностью хранилища, а не отсутствием данных
+func isStoreError(err error) bool {
+	return err != nil && !errors.Is(err, repository.ErrBucketNotFound)
+}
+
+// unavailable возвращает ошибку недоступности хранилища
+func unavailable(err error) error {
+	if err == nil {
+		return repository.ErrStoreUnavailable
+	}
+	return fmt.Errorf("%w: %v", repository.ErrStoreUnavailable, err)
+}
+
+// BucketRepository репозиторий бакетов с резервным хранилищем.
+// Если fallback равен nil, при недоступности основного хранилища возвращается repository.ErrStoreUnavailable
+type BucketRepository struct {
+	primary  repository.BucketRepository
+	fallback repository.BucketRepository
+	health   *Health
+}
+
+// NewBucketRepository создает репозиторий бакетов с резервным хранилищем
+func NewBucketRepository(primary, fallback repository.BucketRepository, health *Health) repository.BucketRepository {
+	return &BucketRepository{
+		primary:  primary,
+		fallback: fallback,
+		health:   health,
+	}
+}
+
+// do выполняет операцию на основном хранилище или на резервном, если основное недоступно
+func (r *BucketRepository) do(op func(repository.BucketRepository) error) error {
+	if r.health.Healthy() {
+		err := op(r.primary)
+		if !isStoreError(err) {
+			return err
+		}
+		r.health.markUnhealthy(err)
+		if r.fallback == nil {
+			return unavailable(err)
+		}
+	}
+
+	if r.fallback == nil {
+		return unavailable(nil)
+	}
+	return op(r.fallback)
+}
+
+// CreateBucket создает новый бакет
+func (r *BucketRepository) CreateBucket(ctx context.Context, key string, capacity int, refilRate int, tokens int) error {
+	return r.do(func(repo repository.BucketRepository) error {
+		return repo.CreateBucket(ctx, key, capacity, refilRate, tokens)
+	})
+}
+
+// Bucket возвращает бакет по ключу
+func (r *BucketRepository) Bucket(ctx context.Context, key string) (*model.Bucket, error) {
+	var b *model.Bucket
+	err := r.do(func(repo repository.BucketRepository) error {
+		var err error
+		b, err = repo.Bucket(ctx, key)
+		return err
+	})
+	return b, err
+}
+
+// Decrease списывает cost токенов, если их хватает
+func (r *BucketRepository) Decrease(ctx context.Context, key string, cost int) (bool, *model.Bucket, error) {
+	var (
+		ok bool
+		b  *model.Bucket
+	)
+	err := r.do(func(repo repository.BucketRepository) error {
+		var err error
+		ok, b, err = repo.Decrease(ctx, key, cost)
+		return err
+	})
+	return ok, b, err
+}
+
+// Charge списывает n токенов, даже если их не хватает
+func (r *BucketRepository) Charge(ctx context.Context, key string, n int) (*model.Bucket, error) {
+	var b *model.Bucket
+	err := r.do(func(repo repository.BucketRepository) error {
+		var err error
+		b, err = repo.Charge(ctx, key, n)
+		return err
+	})
+	return b, err
+}
+
+// RefillAllBuckets пополняет все бакеты токенами
+func (r *BucketRepository) RefillAllBuckets(ctx context.Context) error {
+	return r.do(func(repo repository.BucketRepository) error {
+		return repo.RefillAllBuckets(ctx)
+	})
+}
+
+// UpdateBucketLimits обновляет лимиты существующего бакета
+func (r *BucketRepository) UpdateBucketLimits(ctx context.Context, key string, capacity int, refilRate int) error {
+	return r.do(func(repo repository.BucketRepository) error {
+		return repo.UpdateBucketLimits(ctx, key, capacity, refilRate)
+	})
+}
+
+// UpdateAllBucketLimits обновляет лимиты бакетов в основном и резервном хранилищах,
+// чтобы после переключения бакеты не вернулись к старым лимитам
+func (r *BucketRepository) UpdateAllBucketLimits(ctx context.Context, capacity int, refilRate int, skip func(key string) bool) error {
+	err := r.do(func(repo repository.BucketRepository) error {
+		return repo.UpdateAllBucketLimits(ctx, capacity, refilRate, skip)
+	})
+	if r.fallback != nil && r.health.Healthy() {
+		if ferr := r.fallback.UpdateAllBucketLimits(ctx, capacity, refilRate, skip); ferr != nil {
+			return errors.Join(err, ferr)
+		}
+	}
+	return err
+}
+
+// Acquire списывает из бакета до n токенов
+func (r *BucketRepository) Acquire(ctx context.Context, key string, n int) (int, *model.Bucket, error) {
+	var (
+		granted int
+		b       *model.Bucket
+	)
+	err := r.do(func(repo repository.BucketRepository) error {
+		var err error
+		granted, b, err = repo.Acquire(ctx, key, n)
+		return err
+	})
+	return granted, b, err
+}
+
+// Release возвращает в бакет неиспользованные токены
+func (r *BucketRepository) Release(ctx context.Context, key string, n int) error {
+	return r.do(func(repo repository.BucketRepository) error {
+		return repo.Release(ctx, key, n)
+	})
+}
+
+// WindowRepository репозиторий счетчиков фиксированного окна с резервным хранилищем
+type WindowRepository struct {
+	primary  repository.WindowRepository
+	fallback repository.WindowRepository
+	health   *Health
+}
+
+// NewWindowRepository создает репозиторий счетчиков окна с резервным хранилищем
+func NewWindowRepository(primary, fallback repository.WindowRepository, health *Health) repository.WindowRepository {
+	return &WindowRepository{
+		primary:  primary,
+		fallback: fallback,
+		health:   health,
+	}
+}
+
+// Increment увеличивает счетчик окна
+func (r *WindowRepository) Increment(ctx context.Context, key string, n int, window time.Duration) (int, time.Duration, error) {
+	if r.health.Healthy() {
+		count, ttl, err := r.primary.Increment(ctx, key, n, window)
+		if err == nil {
+			return count, ttl, nil
+		}
+		r.health.markUnhealthy(err)
+		if r.fallback == nil {
+			return 0, 0, unavailable(err)
+		}
+	}
+
+	if r.fallback == nil {
+		return 0, 0, unavailable(nil)
+	}
+	return r.fallback.Increment(ctx, key, n, window)
+}
+
+// ConcurrencyRepository репозиторий слотов одновременных запросов с резервным хранилищем
+type ConcurrencyRepository struct {
+	primary  repository.ConcurrencyRepository
+	fallback repository.ConcurrencyRepository
+	health   *Health
+}
+
+// NewConcurrencyRepository создает репозиторий слотов одновременных запросов с резервным хранилищем
+func NewConcurrencyRepository(primary, fallback repository.ConcurrencyRepository, health *Health) repository.ConcurrencyRepository {
+	return &ConcurrencyRepository{
+		primary:  primary,
+		fallback: fallback,
+		health:   health,
+	}
+}
+
+// do выполняет операцию на основном хранилище или на резервном, если основное недоступно
+func (r *ConcurrencyRepository) do(op func(repository.ConcurrencyRepository) error) error {
+	if r.health.Healthy() {
+		err := op(r.primary)
+		if err == nil {
+			return nil
+		}
+		r.health.markUnhealthy(err)
+		if r.fallback == nil {
+			return unavailable(err)
+		}
+	}
+
+	if r.fallback == nil {
+		return unavailable(nil)
+	}
+	return op(r.fallback)
+}
+
+// AcquireSlot занимает или продлевает слот
+func (r *ConcurrencyRepository) AcquireSlot(ctx context.Context, key string, lease string, limit int, ttl time.Duration) (bool, int, error) {
+	var (
+		ok       bool
+		inFlight int
+	)
+	err := r.do(func(repo repository.ConcurrencyRepository) error {
+		var err error
+		ok, inFlight, err = repo.AcquireSlot(ctx, key, lease, limit, ttl)
+		return err
+	})
+	return ok, inFlight, err
+}
+
+// ReleaseSlot освобождает слот
+func (r *ConcurrencyRepository) ReleaseSlot(ctx context.Context, key string, lease string) error {
+	return r.do(func(repo repository.ConcurrencyRepository) error {
+		return repo.ReleaseSlot(ctx, key, lease)
+	})
+}
+
+// QuotaRepository репозиторий счетчиков квот с резервным хранилищем
+type QuotaRepository struct {
+	primary  repository.QuotaRepository
+	fallback repository.QuotaRepository
+	health   *Health
+}
+
+// NewQuotaRepository создает репозиторий счетчиков квот с резервным хранилищем
+func NewQuotaRepository(primary, fallback repository.QuotaRepository, health *Health) repository.QuotaRepository {
+	return &QuotaRepository{
+		primary:  primary,
+		fallback: fallback,
+		health:   health,
+	}
+}
+
+// do выполняет операцию на основном хранилище или на резервном, если основное недоступно
+func (r *QuotaRepository) do(op func(repository.QuotaRepository) error) error {
+	if r.health.Healthy() {
+		err := op(r.primary)
+		if err == nil {
+			return nil
+		}
+		r.health.markUnhealthy(err)
+		if r.fallback == nil {
+			return unavailable(err)
+		}
+	}
+
+	if r.fallback == nil {
+		return unavailable(nil)
+	}
+	return op(r.fallback)
+}
+
+// ConsumeQuota учитывает запрос в счетчиках квот
+func (r *QuotaRepository) ConsumeQuota(ctx context.Context, key string, periods []model.QuotaPeriod) (bool, []int64, error) {
+	var (
+		ok     bool
+		counts []int64
+	)
+	err := r.do(func(repo repository.QuotaRepository) error {
+		var err error
+		ok, counts, err = repo.ConsumeQuota(ctx, key, periods)
+		return err
+	})
+	return ok, counts, err
+}
+
+// QuotaUsage возвращает значения счетчиков квот
+func (r *QuotaRepository) QuotaUsage(ctx context.Context, key string, periods []model.QuotaPeriod) ([]int64, error) {
+	var counts []int64
+	err := r.do(func(repo repository.QuotaRepository) error {
+		var err error
+		counts, err = repo.QuotaUsage(ctx, key, periods)
+		return err
+	})
+	return counts, err
+}
+
+// ResetQuota обнуляет счетчики квот
+func (r *QuotaRepository) ResetQuota(ctx context.Context, key string, periods []model.QuotaPeriod) error {
+	return r.do(func(repo repository.QuotaRepository) error {
+		return repo.ResetQuota(ctx, key, periods)
+	})
+}
+
+// BanRepository репозиторий блокировок с резервным хранилищем
+type BanRepository struct {
+	primary  repository.BanRepository
+	fallback repository.BanRepository
+	health   *Health
+}
+
+// NewBanRepository создает репозиторий блокировок с резервным хранилищем
+func NewBanRepository(primary, fallback repository.BanRepository, health *Health) repository.BanRepository {
+	return &BanRepository{
+		primary:  primary,
+		fallback: fallback,
+		health:   health,
+	}
+}
+
+// do выполняет операцию на основном хранилище или на резервном, если основное недоступно
+func (r *BanRepository) do(op func(repository.BanRepository) error) error {
+	if r.health.Healthy() {
+		err := op(r.primary)
+		if err == nil || errors.Is(err, repository.ErrBanNotFound) {
+			return err
+		}
+		r.health.markUnhealthy(err)
+		if r.fallback == nil {
+			return unavailable(err)
+		}
+	}
+
+	if r.fallback == nil {
+		return unavailable(nil)
+	}
+	return op(r.fallback)
+}
+
+// Ban блокирует клиента
+func (r *BanRepository) Ban(ctx context.Context, key string, duration, maxDuration, reset time.Duration) (model.Ban, error) {
+	var ban model.Ban
+	err := r.do(func(repo repository.BanRepository) error {
+		var err error
+		ban, err = repo.Ban(ctx, key, duration, maxDuration, reset)
+		return err
+	})
+	return ban, err
+}
+
+// Bans возвращает действующие блокировки
+func (r *BanRepository) Bans(ctx context.Context) ([]model.Ban, error) {
+	var bans []model.Ban
+	err := r.do(func(repo repository.BanRepository) error {
+		var err error
+		bans, err = repo.Bans(ctx)
+		return err
+	})
+	return bans, err
+}
+
+// Unban снимает блокировку клиента
+func (r *BanRepository) Unban(ctx context.Context, key string) error {
+	return r.do(func(repo repository.BanRepository) error {
+		return repo.Unban(ctx, key)
+	})
+}
+
+// OverrideRepository репозиторий переопределений лимитов, который не обращается к хранилищу, пока оно недоступно.
+// Резервного хранилища нет: лимитер продолжает использовать последнюю загруженную копию переопределений,
+// а изменения через административный API возвращают repository.ErrStoreUnavailable
+type OverrideRepository struct {
+	primary repository.OverrideRepository
+	health  *Health
+}
+
+// NewOverrideRepository создает репозиторий переопределений лимитов с учетом доступности хранилища
+func NewOverrideRepository(primary repository.OverrideRepository, health *Health) repository.OverrideRepository {
+	return &OverrideRepository{
+		primary: primary,
+		health:  health,
+	}
+}
+
+// do выполняет операцию на основном хранилище, если оно доступно
+func (r *OverrideRepository) do(op func(repository.OverrideRepository) error) error {
+	if !r.health.Healthy() {
+		return unavailable(nil)
+	}
+	err := op(r.primary)
+	if err == nil || errors.Is(err, repository.ErrOverrideNotFound) {
+		return err
+	}
+	r.health.markUnhealthy(err)
+	return unavailable(err)
+}
+
+// SetOverride создает или обновляет переопределение лимитов
+func (r *OverrideRepository) SetOverride(ctx context.Context, override model.Override) error {
+	return r.do(func(repo repository.OverrideRepository) error {
+		return repo.SetOverride(ctx, override)
+	})
+}
+
+// Override возвращает переопределение лимитов по ключу клиента
+func (r *OverrideRepository) Override(ctx context.Context, key string) (*model.Override, error) {
+	var o *model.Override
+	err := r.do(func(repo repository.OverrideRepository) error {
+		var err error
+		o, err = repo.Override(ctx, key)
+		return err
+	})
+	return o, err
+}
+
+// Overrides возвращает все переопределения лимитов
+func (r *OverrideRepository) Overrides(ctx context.Context) ([]model.Override, error) {
+	var overrides []model.Override
+	err := r.do(func(repo repository.OverrideRepository) error {
+		var err error
+		overrides, err = repo.Overrides(ctx)
+		return err
+	})
+	return overrides, err
+}
+
+// DeleteOverride удаляет переопределение лимитов
+func (r *OverrideRepository) DeleteOverride(ctx context.Context, key string) error {
+	return r.do(func(repo repository.OverrideRepository) error {
+		return repo.DeleteOverride(ctx, key)
+	})
+}
@@ -0,0 +1,103 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/memoryRepository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// brokenRepository репозиторий, чтение бакетов из которого завершается ошибкой err, если она задана
+type brokenRepository struct {
+	*memoryRepository.Repository
+	err error
+}
+
+func (r *brokenRepository) Bucket(ctx context.Context, key string) (*model.Bucket, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.Repository.Bucket(ctx, key)
+}
+
+func (r *brokenRepository) Overrides(ctx context.Context) ([]model.Override, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.Repository.Overrides(ctx)
+}
+
+func newMemoryRepository(t *testing.T) *memoryRepository.Repository {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return memoryRepository.NewMemoryRepository(ctx, config.MemoryStoreConfig{})
+}
+
+func TestBucketRepositoryFallback(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("connection refused")
+
+	primary := &brokenRepository{Repository: newMemoryRepository(t)}
+	var pingErr error
+	health := NewHealth(func() error { return pingErr })
+	require.True(t, health.Healthy())
+
+	local := newMemoryRepository(t)
+	require.NoError(t, local.CreateBucket(ctx, "k", 10, 1, 5))
+	repo := NewBucketRepository(primary, local, health)
+
+	_, err := repo.Bucket(ctx, "k")
+	assert.ErrorIs(t, err, repository.ErrBucketNotFound, "not found is not a store error")
+	assert.True(t, health.Healthy())
+
+	primary.err, pingErr = errDown, errDown
+	b, err := repo.Bucket(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 5, b.Tokens, "bucket is served from the local store")
+	assert.False(t, health.Healthy())
+
+	primary.err, pingErr = nil, nil
+	health.check()
+	assert.True(t, health.Healthy())
+	_, err = repo.Bucket(ctx, "k")
+	assert.ErrorIs(t, err, repository.ErrBucketNotFound, "primary is used again after recovery")
+}
+
+func TestBucketRepositoryWithoutFallback(t *testing.T) {
+	health := NewHealth(func() error { return errors.New("connection refused") })
+	repo := NewBucketRepository(newMemoryRepository(t), nil, health)
+
+	_, err := repo.Bucket(context.Background(), "k")
+	assert.ErrorIs(t, err, repository.ErrStoreUnavailable)
+}
+
+func TestOverrideRepositoryUnavailable(t *testing.T) {
+	ctx := context.Background()
+	errDown := errors.New("connection refused")
+
+	primary := &brokenRepository{Repository: newMemoryRepository(t)}
+	var pingErr error
+	health := NewHealth(func() error { return pingErr })
+	repo := NewOverrideRepository(primary, health)
+
+	_, err := repo.Override(ctx, "k")
+	assert.ErrorIs(t, err, repository.ErrOverrideNotFound)
+	assert.True(t, health.Healthy())
+
+	primary.err, pingErr = errDown, errDown
+	_, err = repo.Overrides(ctx)
+	assert.ErrorIs(t, err, repository.ErrStoreUnavailable)
+	assert.False(t, health.Healthy())
+
+	// пока хранилище недоступно, обращений к нему нет
+	primary.err = nil
+	assert.ErrorIs(t, repo.SetOverride(ctx, model.Override{Key: "k", Capacity: 1}), repository.ErrStoreUnavailable)
+	_, err = primary.Override(ctx, "k")
+	assert.ErrorIs(t, err, repository.ErrOverrideNotFound)
+}
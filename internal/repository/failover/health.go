@@ -0,0 +1,67 @@
+package failover
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// Health отслеживает доступность основного хранилища.
+// После ошибки хранилище считается недоступным, пока оно снова не ответит на ping.
+type Health struct {
+	ping    func() error
+	healthy atomic.Bool
+}
+
+// NewHealth создает монитор доступности и сразу проверяет хранилище
+func NewHealth(ping func() error) *Health {
+	h := &Health{ping: ping}
+	if err := ping(); err != nil {
+		slog.Warn("Store is unavailable", "error", err)
+	} else {
+		h.healthy.Store(true)
+	}
+	return h
+}
+
+// Start запускает периодическую проверку доступности хранилища
+func (h *Health) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				h.check()
+			}
+		}
+	}()
+}
+
+// check проверяет хранилище и логирует смену состояния
+func (h *Health) check() {
+	err := h.ping()
+	switch {
+	case err == nil && h.healthy.CompareAndSwap(false, true):
+		slog.Info("Store connection restored")
+	case err != nil && h.healthy.CompareAndSwap(true, false):
+		slog.Error("Store connection lost", "error", err)
+	}
+}
+
+// Healthy возвращает true, если хранилище доступно
+func (h *Health) Healthy() bool {
+	return h.healthy.Load()
+}
+
+// markUnhealthy помечает хранилище недоступным после ошибки операции
+func (h *Health) markUnhealthy(err error) {
+	if h.healthy.CompareAndSwap(true, false) {
+		slog.Error("Store connection lost", "error", err)
+	}
+}
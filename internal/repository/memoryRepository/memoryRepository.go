@@ -0,0 +1,544 @@
+// Package memoryRepository предоставляет реализацию репозиториев rate limiter в памяти процесса.
+// Используется для локального запуска без Redis и как резервное хранилище, пока Redis недоступен.
+package memoryRepository
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+const (
+	defaultShards          = 64
+	defaultCleanupInterval = time.Minute
+)
+
+// Repository хранилище бакетов, счетчиков фиксированного окна, слотов одновременных запросов,
+// счетчиков квот, блокировок и переопределений лимитов в памяти.
+// Ключи распределены по шардам, у каждого шарда своя блокировка.
+// Бакеты, к которым не обращались дольше bucket_ttl, удаляются, чтобы ограничить потребление памяти.
+type Repository struct {
+	shards    []*shard
+	bucketTTL time.Duration
+
+	overridesMu sync.RWMutex
+	overrides   map[string]model.Override
+
+	bansMu sync.Mutex
+	bans   map[string]ban
+}
+
+type shard struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	windows map[string]*window
+	slots   map[string]map[string]time.Time // время истечения слотов по ключу клиента и идентификатору слота
+	quotas  map[string]*window              // счетчики квот по ключу клиента и идентификатору периода
+}
+
+type bucket struct {
+	model.Bucket
+	lastAccess time.Time
+}
+
+type ban struct {
+	model.Ban
+	forget time.Time // время, после которого блокировка не учитывается при следующей
+}
+
+type window struct {
+	count   int
+	expires time.Time
+}
+
+// NewMemoryRepository создает новое хранилище в памяти и запускает очистку устаревших записей
+func NewMemoryRepository(ctx context.Context, cfg config.MemoryStoreConfig) *Repository {
+	shards := cfg.Shards
+	if shards <= 0 {
+		shards = defaultShards
+	}
+
+	r := &Repository{
+		shards:    make([]*shard, shards),
+		bucketTTL: cfg.BucketTTL,
+		overrides: make(map[string]model.Override),
+		bans:      make(map[string]ban),
+	}
+	for i := range r.shards {
+		r.shards[i] = &shard{
+			buckets: make(map[string]*bucket),
+			windows: make(map[string]*window),
+			slots:   make(map[string]map[string]time.Time),
+			quotas:  make(map[string]*window),
+		}
+	}
+
+	interval := cfg.CleanupInterval
+	if interval <= 0 {
+		interval = defaultCleanupInterval
+	}
+	r.startCleanup(ctx, interval)
+
+	return r
+}
+
+// shard возвращает шард для ключа
+func (r *Repository) shard(key string) *shard {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return r.shards[h.Sum32()%uint32(len(r.shards))]
+}
+
+// startCleanup периодически удаляет истекшие окна, слоты, квоты и блокировки и неиспользуемые бакеты
+func (r *Repository) startCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				r.cleanup(now)
+			}
+		}
+	}()
+}
+
+func (r *Repository) cleanup(now time.Time) {
+	for _, s := range r.shards {
+		s.mu.Lock()
+		for key, w := range s.windows {
+			if !now.Before(w.expires) {
+				delete(s.windows, key)
+			}
+		}
+		for key, q := range s.quotas {
+			if !now.Before(q.expires) {
+				delete(s.quotas, key)
+			}
+		}
+		for key, leases := range s.slots {
+			expireSlots(leases, now)
+			if len(leases) == 0 {
+				delete(s.slots, key)
+			}
+		}
+		if r.bucketTTL > 0 {
+			for key, b := range s.buckets {
+				if now.Sub(b.lastAccess) <= r.bucketTTL {
+					continue
+				}
+				// удаляется только заполненный бакет: новый бакет создается заполненным,
+				// и удаление бакета с долгом после Charge сняло бы ограничение с клиента
+				b.refill(now)
+				if b.Tokens >= b.Capacity {
+					delete(s.buckets, key)
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	r.bansMu.Lock()
+	for key, b := range r.bans {
+		if !now.Before(b.forget) {
+			delete(r.bans, key)
+		}
+	}
+	r.bansMu.Unlock()
+}
+
+// CreateBucket создает новый бакет
+func (r *Repository) CreateBucket(_ context.Context, key string, capacity int, refilRate int, tokens int) error {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buckets[key] = &bucket{
+		Bucket: model.Bucket{
+			Tokens:     tokens,
+			Capacity:   capacity,
+			RefilRate:  refilRate,
+			LastRefill: time.Unix(now.Unix(), 0),
+		},
+		lastAccess: now,
+	}
+	return nil
+}
+
+// Bucket возвращает копию бакета по ключу
+func (r *Repository) Bucket(_ context.Context, key string) (*model.Bucket, error) {
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		return nil, repository.ErrBucketNotFound
+	}
+	copied := b.Bucket
+	return &copied, nil
+}
+
+// Decrease пополняет бакет за прошедшее время и списывает cost токенов, если их хватает, как скрипт в Redis
+func (r *Repository) Decrease(_ context.Context, key string, cost int) (bool, *model.Bucket, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		return false, nil, repository.ErrBucketNotFound
+	}
+
+	b.refill(now)
+	b.lastAccess = now
+	allowed := b.Tokens >= cost
+	if allowed {
+		b.Tokens -= cost
+	}
+
+	copied := b.Bucket
+	return allowed, &copied, nil
+}
+
+// Charge пополняет бакет и списывает n токенов, даже если их не хватает
+func (r *Repository) Charge(_ context.Context, key string, n int) (*model.Bucket, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		return nil, repository.ErrBucketNotFound
+	}
+
+	b.refill(now)
+	b.lastAccess = now
+	b.Tokens -= n
+
+	copied := b.Bucket
+	return &copied, nil
+}
+
+// RefillAllBuckets пополняет все бакеты токенами
+func (r *Repository) RefillAllBuckets(ctx context.Context) error {
+	now := time.Now()
+	for _, s := range r.shards {
+		s.mu.Lock()
+		for _, b := range s.buckets {
+			b.refill(now)
+		}
+		s.mu.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateBucketLimits обновляет емкость и скорость пополнения существующего бакета
+func (r *Repository) UpdateBucketLimits(_ context.Context, key string, capacity int, refilRate int) error {
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.Capacity, b.RefilRate, b.Tokens = capacity, refilRate, min(b.Tokens, capacity)
+	}
+	return nil
+}
+
+// UpdateAllBucketLimits обновляет емкость и скорость пополнения всех бакетов, кроме пропущенных skip
+func (r *Repository) UpdateAllBucketLimits(_ context.Context, capacity int, refilRate int, skip func(key string) bool) error {
+	for _, s := range r.shards {
+		s.mu.Lock()
+		for key, b := range s.buckets {
+			if !skip(key) {
+				b.Capacity, b.RefilRate, b.Tokens = capacity, refilRate, min(b.Tokens, capacity)
+			}
+		}
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// Acquire списывает из бакета до n токенов и возвращает количество списанных токенов
+func (r *Repository) Acquire(_ context.Context, key string, n int) (int, *model.Bucket, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.buckets[key]
+	if !ok {
+		return 0, nil, repository.ErrBucketNotFound
+	}
+
+	b.refill(now)
+	b.lastAccess = now
+	granted := max(0, min(b.Tokens, n))
+	b.Tokens -= granted
+
+	copied := b.Bucket
+	return granted, &copied, nil
+}
+
+// Release возвращает в бакет неиспользованные токены, не превышая его емкость
+func (r *Repository) Release(_ context.Context, key string, n int) error {
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if b, ok := s.buckets[key]; ok {
+		b.Tokens = min(b.Capacity, b.Tokens+n)
+	}
+	return nil
+}
+
+// refill пополняет бакет с точностью до секунды
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Unix() - b.LastRefill.Unix()
+	if elapsed <= 0 {
+		return
+	}
+	b.Tokens = min(b.Capacity, b.Tokens+int(elapsed)*b.RefilRate)
+	b.LastRefill = time.Unix(now.Unix(), 0)
+}
+
+// Increment увеличивает счетчик окна на n. Окно начинается с первого запроса и живет window
+func (r *Repository) Increment(_ context.Context, key string, n int, windowSize time.Duration) (int, time.Duration, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w, ok := s.windows[key]
+	if !ok || !now.Before(w.expires) {
+		w = &window{expires: now.Add(windowSize)}
+		s.windows[key] = w
+	}
+	w.count += n
+
+	return w.count, w.expires.Sub(now), nil
+}
+
+// AcquireSlot занимает слот, если занято меньше limit слотов, или продлевает уже занятый слот
+func (r *Repository) AcquireSlot(_ context.Context, key string, lease string, limit int, ttl time.Duration) (bool, int, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	leases, ok := s.slots[key]
+	if !ok {
+		leases = make(map[string]time.Time)
+		s.slots[key] = leases
+	}
+	expireSlots(leases, now)
+
+	if _, ok := leases[lease]; !ok && len(leases) >= limit {
+		return false, len(leases), nil
+	}
+	leases[lease] = now.Add(ttl)
+	return true, len(leases), nil
+}
+
+// ReleaseSlot освобождает слот
+func (r *Repository) ReleaseSlot(_ context.Context, key string, lease string) error {
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if leases, ok := s.slots[key]; ok {
+		delete(leases, lease)
+		if len(leases) == 0 {
+			delete(s.slots, key)
+		}
+	}
+	return nil
+}
+
+// expireSlots удаляет слоты, истекшие к моменту now
+func expireSlots(leases map[string]time.Time, now time.Time) {
+	for lease, expires := range leases {
+		if !now.Before(expires) {
+			delete(leases, lease)
+		}
+	}
+}
+
+// quotaKey возвращает ключ счетчика квоты клиента за период
+func quotaKey(key string, period model.QuotaPeriod) string {
+	return key + "|" + period.ID
+}
+
+// ConsumeQuota увеличивает счетчики всех периодов, если ни одна квота не исчерпана
+func (r *Repository) ConsumeQuota(_ context.Context, key string, periods []model.QuotaPeriod) (bool, []int64, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make([]int64, len(periods))
+	allowed := true
+	for i, period := range periods {
+		if q, ok := s.quotas[quotaKey(key, period)]; ok && now.Before(q.expires) {
+			counts[i] = int64(q.count)
+		}
+		if counts[i] >= period.Limit {
+			allowed = false
+		}
+	}
+	if !allowed {
+		return false, counts, nil
+	}
+
+	for i, period := range periods {
+		qk := quotaKey(key, period)
+		q, ok := s.quotas[qk]
+		if !ok || !now.Before(q.expires) {
+			q = &window{expires: period.Reset}
+			s.quotas[qk] = q
+		}
+		q.count++
+		counts[i] = int64(q.count)
+	}
+	return true, counts, nil
+}
+
+// QuotaUsage возвращает значения счетчиков квот
+func (r *Repository) QuotaUsage(_ context.Context, key string, periods []model.QuotaPeriod) ([]int64, error) {
+	now := time.Now()
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make([]int64, len(periods))
+	for i, period := range periods {
+		if q, ok := s.quotas[quotaKey(key, period)]; ok && now.Before(q.expires) {
+			counts[i] = int64(q.count)
+		}
+	}
+	return counts, nil
+}
+
+// ResetQuota обнуляет счетчики квот
+func (r *Repository) ResetQuota(_ context.Context, key string, periods []model.QuotaPeriod) error {
+	s := r.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, period := range periods {
+		delete(s.quotas, quotaKey(key, period))
+	}
+	return nil
+}
+
+// Ban блокирует клиента
+func (r *Repository) Ban(_ context.Context, key string, duration, maxDuration, reset time.Duration) (model.Ban, error) {
+	now := time.Now()
+	r.bansMu.Lock()
+	defer r.bansMu.Unlock()
+
+	strikes := 0
+	if b, ok := r.bans[key]; ok {
+		if now.Before(b.Until) {
+			// повторные нарушения во время блокировки ее не продлевают
+			return b.Ban, nil
+		}
+		if now.Before(b.forget) {
+			strikes = b.Strikes
+		}
+	}
+	for i := 0; i < strikes && duration < maxDuration; i++ {
+		duration *= 2
+	}
+	duration = min(duration, maxDuration)
+
+	b := ban{Ban: model.Ban{Key: key, Until: now.Add(duration), Strikes: strikes + 1}}
+	b.forget = b.Until.Add(reset)
+	r.bans[key] = b
+	return b.Ban, nil
+}
+
+// Bans возвращает действующие блокировки, отсортированные по ключу
+func (r *Repository) Bans(_ context.Context) ([]model.Ban, error) {
+	now := time.Now()
+	r.bansMu.Lock()
+	defer r.bansMu.Unlock()
+	bans := make([]model.Ban, 0, len(r.bans))
+	for _, b := range r.bans {
+		if now.Before(b.Until) {
+			bans = append(bans, b.Ban)
+		}
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Key < bans[j].Key })
+	return bans, nil
+}
+
+// Unban снимает блокировку клиента
+func (r *Repository) Unban(_ context.Context, key string) error {
+	r.bansMu.Lock()
+	defer r.bansMu.Unlock()
+	if _, ok := r.bans[key]; !ok {
+		return repository.ErrBanNotFound
+	}
+	delete(r.bans, key)
+	return nil
+}
+
+// SetOverride создает или обновляет переопределение лимитов
+func (r *Repository) SetOverride(_ context.Context, override model.Override) error {
+	r.overridesMu.Lock()
+	defer r.overridesMu.Unlock()
+	r.overrides[override.Key] = override
+	return nil
+}
+
+// Override возвращает переопределение лимитов по ключу клиента
+func (r *Repository) Override(_ context.Context, key string) (*model.Override, error) {
+	r.overridesMu.RLock()
+	defer r.overridesMu.RUnlock()
+	o, ok := r.overrides[key]
+	if !ok {
+		return nil, repository.ErrOverrideNotFound
+	}
+	return &o, nil
+}
+
+// Overrides возвращает все переопределения лимитов, отсортированные по ключу
+func (r *Repository) Overrides(_ context.Context) ([]model.Override, error) {
+	r.overridesMu.RLock()
+	defer r.overridesMu.RUnlock()
+	overrides := make([]model.Override, 0, len(r.overrides))
+	for _, o := range r.overrides {
+		overrides = append(overrides, o)
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Key < overrides[j].Key })
+	return overrides, nil
+}
+
+// DeleteOverride удаляет переопределение лимитов
+func (r *Repository) DeleteOverride(_ context.Context, key string) error {
+	r.overridesMu.Lock()
+	defer r.overridesMu.Unlock()
+	if _, ok := r.overrides[key]; !ok {
+		return repository.ErrOverrideNotFound
+	}
+	delete(r.overrides, key)
+	return nil
+}
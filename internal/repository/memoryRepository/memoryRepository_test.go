@@ -0,0 +1,141 @@
+package memoryRepository
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+)
+
+func newTestRepository(t *testing.T, cfg config.MemoryStoreConfig) *Repository {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return NewMemoryRepository(ctx, cfg)
+}
+
+func TestDecrease(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t, config.MemoryStoreConfig{})
+
+	_, _, err := r.Decrease(ctx, "k", 1)
+	assert.ErrorIs(t, err, repository.ErrBucketNotFound)
+
+	require.NoError(t, r.CreateBucket(ctx, "k", 3, 1, 1))
+	ok, b, err := r.Decrease(ctx, "k", 1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, b.Tokens)
+
+	ok, _, err = r.Decrease(ctx, "k", 1)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// лениво пополняем бакет за прошедшие 2 секунды
+	s := r.shard("k")
+	s.mu.Lock()
+	s.buckets["k"].LastRefill = s.buckets["k"].LastRefill.Add(-2 * time.Second)
+	s.mu.Unlock()
+
+	ok, b, err = r.Decrease(ctx, "k", 1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, b.Tokens)
+}
+
+func TestDecreaseConcurrent(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t, config.MemoryStoreConfig{Shards: 4})
+	require.NoError(t, r.CreateBucket(ctx, "k", 100, 0, 100))
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := r.Decrease(ctx, "k", 1)
+			assert.NoError(t, err)
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 100, allowed)
+}
+
+func TestIncrementAndCleanup(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t, config.MemoryStoreConfig{BucketTTL: time.Minute})
+
+	count, ttl, err := r.Increment(ctx, "w", 1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.LessOrEqual(t, ttl, time.Second)
+
+	count, _, err = r.Increment(ctx, "w", 1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	require.NoError(t, r.CreateBucket(ctx, "b", 1, 1, 1))
+	r.cleanup(time.Now().Add(2 * time.Minute))
+
+	_, err = r.Bucket(ctx, "b")
+	assert.ErrorIs(t, err, repository.ErrBucketNotFound, "idle bucket is removed")
+	count, _, err = r.Increment(ctx, "w", 1, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count, "expired window starts over")
+}
+
+func TestCleanupKeepsIndebtedBucket(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRepository(t, config.MemoryStoreConfig{BucketTTL: time.Minute})
+
+	require.NoError(t, r.CreateBucket(ctx, "k", 10, 1, 10))
+	_, err := r.Charge(ctx, "k", 300)
+	require.NoError(t, err)
+
+	// клиент с долгом получает отказы через Bucket и не обновляет время обращения
+	r.cleanup(time.Now().Add(2 * time.Minute))
+	b, err := r.Bucket(ctx, "k")
+	require.NoError(t, err, "bucket with debt is kept")
+	assert.Less(t, b.Tokens, b.Capacity)
+
+	// после погашения долга бакет удаляется
+	r.cleanup(time.Now().Add(time.Hour))
+	_, err = r.Bucket(ctx, "k")
+	assert.ErrorIs(t, err, repository.ErrBucketNotFound)
+}
+
+func TestBanWhileActive(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRepository(t, config.MemoryStoreConfig{})
+
+	ban, err := repo.Ban(ctx, "k", time.Minute, time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 1, ban.Strikes)
+
+	again, err := repo.Ban(ctx, "k", time.Minute, time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, ban, again, "active ban is not extended")
+
+	// после окончания блокировки следующая длится вдвое дольше
+	b := repo.bans["k"]
+	b.Until = time.Now().Add(-time.Second)
+	repo.bans["k"] = b
+	ban, err = repo.Ban(ctx, "k", time.Minute, time.Hour, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 2, ban.Strikes)
+	assert.WithinDuration(t, time.Now().Add(2*time.Minute), ban.Until, time.Second)
+}
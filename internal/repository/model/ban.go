@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Ban временная блокировка клиента, который превышает лимит слишком часто
+type Ban struct {
+	Key     string    `json:"key"`
+	Until   time.Time `json:"until"`   // окончание блокировки
+	Strikes int       `json:"strikes"` // номер блокировки подряд, от него зависит ее длительность
+}
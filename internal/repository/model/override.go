@@ -0,0 +1,9 @@
+package model
+
+// Override переопределение лимитов бакета для конкретного ключа клиента
+type Override struct {
+	Key       string `json:"key"`
+	Capacity  int    `json:"capacity,omitempty"`
+	RefilRate int    `json:"refil_rate,omitempty"`
+	Unlimited bool   `json:"unlimited,omitempty"`
+}
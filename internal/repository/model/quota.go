@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// QuotaPeriod текущий период квоты клиента
+type QuotaPeriod struct {
+	ID    string    // идентификатор периода, например day:2024-05-01 или month:2024-05
+	Limit int64     // количество запросов за период
+	Reset time.Time // окончание периода
+}
@@ -0,0 +1,106 @@
+package redisRepository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// bansKey хэш, в котором хранятся блокировки в формате ключ клиента -> JSON
+const bansKey = "ratelimit:bans"
+
+// banRecord блокировка в хэше bansKey, время в секундах
+type banRecord struct {
+	Expires int64 `json:"expires"` // окончание блокировки
+	Forget  int64 `json:"forget"`  // время, после которого блокировка не учитывается при следующей
+	Strikes int   `json:"strikes"`
+}
+
+// BanRepository реализация repository.BanRepository в Redis.
+// Все блокировки хранятся в одном хэше, чтобы их можно было получить одним запросом и в Redis Cluster
+type BanRepository struct {
+	client redis.UniversalClient
+}
+
+// NewBanRepository создает новый репозиторий блокировок
+func NewBanRepository(redis redis.UniversalClient) (repository.BanRepository, error) {
+	if redis == nil {
+		return nil, ErrRedisClientNil
+	}
+	loadScripts(redis, banScript, bansScript)
+	return &BanRepository{
+		client: redis,
+	}, nil
+}
+
+// Ban блокирует клиента
+func (r *BanRepository) Ban(_ context.Context, key string, duration, maxDuration, reset time.Duration) (model.Ban, error) {
+	result, err := banScript.Run(r.client, []string{bansKey},
+		key, time.Now().Unix(), ceilSeconds(duration), ceilSeconds(maxDuration), ceilSeconds(reset)).Result()
+	if err != nil {
+		return model.Ban{}, fmt.Errorf("failed to ban: %w", err)
+	}
+
+	fields, err := int64Slice(result, 2)
+	if err != nil {
+		return model.Ban{}, err
+	}
+
+	return model.Ban{Key: key, Until: time.Unix(fields[0], 0), Strikes: int(fields[1])}, nil
+}
+
+// Bans возвращает действующие блокировки, отсортированные по ключу.
+// Забытые блокировки при этом удаляются из хэша, поврежденные записи пропускаются
+func (r *BanRepository) Bans(_ context.Context) ([]model.Ban, error) {
+	now := time.Now().Unix()
+	result, err := bansScript.Run(r.client, []string{bansKey}, now).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bans: %w", err)
+	}
+	entries, ok := result.([]interface{})
+	if !ok || len(entries)%2 != 0 {
+		return nil, fmt.Errorf("unexpected result format: %v", result)
+	}
+
+	bans := make([]model.Ban, 0, len(entries)/2)
+	for i := 0; i < len(entries); i += 2 {
+		key, _ := entries[i].(string)
+		data, _ := entries[i+1].(string)
+		var record banRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil {
+			slog.Warn("Skipping corrupt ban record", "error", err)
+			continue
+		}
+		if record.Expires > now {
+			bans = append(bans, model.Ban{Key: key, Until: time.Unix(record.Expires, 0), Strikes: record.Strikes})
+		}
+	}
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].Key < bans[j].Key })
+	return bans, nil
+}
+
+// Unban снимает блокировку клиента
+func (r *BanRepository) Unban(_ context.Context, key string) error {
+	deleted, err := r.client.HDel(bansKey, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to unban: %w", err)
+	}
+	if deleted == 0 {
+		return repository.ErrBanNotFound
+	}
+	return nil
+}
+
+// ceilSeconds переводит длительность в секунды с округлением вверх
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,131 @@
+package redisRepository
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/config"
+)
+
+const (
+	// ModeSingle один узел Redis
+	ModeSingle = "single"
+	// ModeSentinel мастер, адрес которого определяется через Redis Sentinel
+	ModeSentinel = "sentinel"
+	// ModeCluster Redis Cluster
+	ModeCluster = "cluster"
+)
+
+// ErrInvalidRedisConfig ошибка, если конфигурация Redis некорректна
+var ErrInvalidRedisConfig = errors.New("invalid redis config")
+
+// NewClient создает клиент Redis для режима из конфигурации.
+// Соединение при создании не проверяется
+func NewClient(cfg config.RedisConfig) (redis.UniversalClient, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+
+	password, db := cfg.Password, cfg.DB
+	var onConnect func(*redis.Conn) error
+	if cfg.Username != "" {
+		// go-redis отправляет AUTH только с паролем, поэтому для пользователя ACL
+		// аутентификация и выбор базы выполняются при установке соединения
+		password, db = "", 0
+		onConnect = func(conn *redis.Conn) error {
+			if err := conn.Do("AUTH", cfg.Username, cfg.Password).Err(); err != nil {
+				return err
+			}
+			if cfg.DB > 0 {
+				return conn.Select(cfg.DB).Err()
+			}
+			return nil
+		}
+	}
+
+	var client redis.UniversalClient
+	switch cfg.Mode {
+	case "", ModeSingle:
+		addr := cfg.Addr
+		if addr == "" && len(cfg.Addrs) > 0 {
+			addr = cfg.Addrs[0]
+		}
+		client = redis.NewClient(&redis.Options{
+			Addr:      addr,
+			Password:  password,
+			DB:        db,
+			OnConnect: onConnect,
+			TLSConfig: tlsConfig,
+		})
+	case ModeSentinel:
+		if cfg.MasterName == "" || len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("%w: sentinel mode requires master_name and addrs", ErrInvalidRedisConfig)
+		}
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:    cfg.MasterName,
+			SentinelAddrs: cfg.Addrs,
+			Password:      password,
+			DB:            db,
+			OnConnect:     onConnect,
+			TLSConfig:     tlsConfig,
+		})
+	case ModeCluster:
+		if len(cfg.Addrs) == 0 {
+			return nil, fmt.Errorf("%w: cluster mode requires addrs", ErrInvalidRedisConfig)
+		}
+		if cfg.DB != 0 {
+			return nil, fmt.Errorf("%w: cluster mode supports only db 0", ErrInvalidRedisConfig)
+		}
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.Addrs,
+			Password:  password,
+			OnConnect: onConnect,
+			TLSConfig: tlsConfig,
+		})
+	default:
+		return nil, fmt.Errorf("%w: unknown mode %q", ErrInvalidRedisConfig, cfg.Mode)
+	}
+
+	instrument(client)
+	return client, nil
+}
+
+// newTLSConfig создает конфигурацию TLS, возвращает nil, если TLS выключен
+func newTLSConfig(cfg config.RedisTLSConfig) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates in %s", ErrInvalidRedisConfig, cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,56 @@
+package redisRepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+)
+
+// ConcurrencyRepository реализация repository.ConcurrencyRepository в Redis.
+// Слоты клиента хранятся в sorted set, оценка элемента - время истечения слота в миллисекундах
+type ConcurrencyRepository struct {
+	client redis.UniversalClient
+}
+
+// NewConcurrencyRepository создает новый репозиторий слотов одновременных запросов
+func NewConcurrencyRepository(redis redis.UniversalClient) (repository.ConcurrencyRepository, error) {
+	if redis == nil {
+		return nil, ErrRedisClientNil
+	}
+	loadScripts(redis, acquireSlotScript)
+	return &ConcurrencyRepository{
+		client: redis,
+	}, nil
+}
+
+// concurrencyKey возвращает ключ слотов клиента в Redis, ключ клиента заключен в hash tag, как у бакета
+func concurrencyKey(key string) string {
+	return fmt.Sprintf("ratelimit:concurrency:{%s}", key)
+}
+
+// AcquireSlot занимает слот, если занято меньше limit слотов, или продлевает уже занятый слот
+func (r *ConcurrencyRepository) AcquireSlot(_ context.Context, key string, lease string, limit int, ttl time.Duration) (bool, int, error) {
+	now := time.Now().UnixMilli()
+	result, err := acquireSlotScript.Run(r.client, []string{concurrencyKey(key)}, lease, now, limit, ttl.Milliseconds()).Result()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to acquire slot: %w", err)
+	}
+
+	fields, err := int64Slice(result, 2)
+	if err != nil {
+		return false, 0, err
+	}
+
+	return fields[0] == 1, int(fields[1]), nil
+}
+
+// ReleaseSlot освобождает слот
+func (r *ConcurrencyRepository) ReleaseSlot(_ context.Context, key string, lease string) error {
+	if err := r.client.ZRem(concurrencyKey(key), lease).Err(); err != nil {
+		return fmt.Errorf("failed to release slot: %w", err)
+	}
+	return nil
+}
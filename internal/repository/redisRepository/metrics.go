@@ -0,0 +1,57 @@
+package redisRepository
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/metrics"
+)
+
+// scriptNames имена Lua скриптов для метрик по SHA1 для EVALSHA и по исходному коду для EVAL
+var scriptNames = map[string]string{}
+
+// newScript создает Lua скрипт и запоминает его имя для метрик
+func newScript(name, src string) *redis.Script {
+	script := redis.NewScript(src)
+	scriptNames[script.Hash()] = name
+	scriptNames[src] = name
+	return script
+}
+
+// instrument учитывает время выполнения команд и конвейеров client в метриках
+func instrument(client redis.UniversalClient) {
+	client.WrapProcess(func(process func(redis.Cmder) error) func(redis.Cmder) error {
+		return func(cmd redis.Cmder) error {
+			start := time.Now()
+			err := process(cmd)
+			metrics.ObserveRedis(operation(cmd), err, time.Since(start))
+			return err
+		}
+	})
+	client.WrapProcessPipeline(func(process func([]redis.Cmder) error) func([]redis.Cmder) error {
+		return func(cmds []redis.Cmder) error {
+			start := time.Now()
+			err := process(cmds)
+			metrics.ObserveRedis("pipeline", err, time.Since(start))
+			return err
+		}
+	})
+}
+
+// operation возвращает имя операции для метрик: имя скрипта для EVAL и EVALSHA, иначе имя команды
+func operation(cmd redis.Cmder) string {
+	name := strings.ToLower(cmd.Name())
+	args := cmd.Args()
+	if len(args) < 2 {
+		return name
+	}
+	if name != "evalsha" && name != "eval" {
+		return name
+	}
+	if script, ok := scriptNames[fmt.Sprint(args[1])]; ok {
+		return "script:" + script
+	}
+	return name
+}
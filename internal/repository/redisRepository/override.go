@@ -0,0 +1,89 @@
+package redisRepository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// overridesKey хэш, в котором хранятся переопределения лимитов в формате ключ клиента -> JSON
+const overridesKey = "ratelimit:overrides"
+
+// OverrideRepository реализация repository.OverrideRepository в Redis
+type OverrideRepository struct {
+	client redis.UniversalClient
+}
+
+// NewOverrideRepository создает новый репозиторий переопределений лимитов
+func NewOverrideRepository(redis redis.UniversalClient) (repository.OverrideRepository, error) {
+	if redis == nil {
+		return nil, ErrRedisClientNil
+	}
+	return &OverrideRepository{
+		client: redis,
+	}, nil
+}
+
+// SetOverride создает или обновляет переопределение лимитов
+func (r *OverrideRepository) SetOverride(_ context.Context, override model.Override) error {
+	data, err := json.Marshal(override)
+	if err != nil {
+		return fmt.Errorf("failed to marshal override: %w", err)
+	}
+
+	if err := r.client.HSet(overridesKey, override.Key, data).Err(); err != nil {
+		return fmt.Errorf("failed to set override: %w", err)
+	}
+	return nil
+}
+
+// Override возвращает переопределение лимитов по ключу клиента
+func (r *OverrideRepository) Override(_ context.Context, key string) (*model.Override, error) {
+	data, err := r.client.HGet(overridesKey, key).Bytes()
+	if err == redis.Nil {
+		return nil, repository.ErrOverrideNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get override: %w", err)
+	}
+
+	var override model.Override
+	if err := json.Unmarshal(data, &override); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal override: %w", err)
+	}
+	return &override, nil
+}
+
+// Overrides возвращает все переопределения лимитов
+func (r *OverrideRepository) Overrides(_ context.Context) ([]model.Override, error) {
+	result, err := r.client.HGetAll(overridesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get overrides: %w", err)
+	}
+
+	overrides := make([]model.Override, 0, len(result))
+	for key, data := range result {
+		var override model.Override
+		if err := json.Unmarshal([]byte(data), &override); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal override %q: %w", key, err)
+		}
+		overrides = append(overrides, override)
+	}
+	return overrides, nil
+}
+
+// DeleteOverride удаляет переопределение лимитов
+func (r *OverrideRepository) DeleteOverride(_ context.Context, key string) error {
+	deleted, err := r.client.HDel(overridesKey, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to delete override: %w", err)
+	}
+	if deleted == 0 {
+		return repository.ErrOverrideNotFound
+	}
+	return nil
+}
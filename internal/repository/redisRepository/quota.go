@@ -0,0 +1,86 @@
+package redisRepository
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+// QuotaRepository реализация repository.QuotaRepository в Redis.
+// Счетчик каждого периода хранится в отдельном ключе, который удаляется по окончании периода
+type QuotaRepository struct {
+	client redis.UniversalClient
+}
+
+// NewQuotaRepository создает новый репозиторий счетчиков квот
+func NewQuotaRepository(redis redis.UniversalClient) (repository.QuotaRepository, error) {
+	if redis == nil {
+		return nil, ErrRedisClientNil
+	}
+	loadScripts(redis, consumeQuotaScript)
+	return &QuotaRepository{
+		client: redis,
+	}, nil
+}
+
+// quotaKeys возвращает ключи счетчиков периодов в Redis. Ключ клиента заключен в hash tag,
+// поэтому счетчики всех периодов находятся в одном слоте и обновляются одним скриптом
+func quotaKeys(key string, periods []model.QuotaPeriod) []string {
+	keys := make([]string, len(periods))
+	for i, period := range periods {
+		keys[i] = fmt.Sprintf("ratelimit:quota:{%s}:%s", key, period.ID)
+	}
+	return keys
+}
+
+// ConsumeQuota увеличивает счетчики всех периодов, если ни одна квота не исчерпана
+func (r *QuotaRepository) ConsumeQuota(_ context.Context, key string, periods []model.QuotaPeriod) (bool, []int64, error) {
+	args := make([]interface{}, 0, 2*len(periods))
+	for _, period := range periods {
+		args = append(args, period.Limit, period.Reset.Unix())
+	}
+
+	result, err := consumeQuotaScript.Run(r.client, quotaKeys(key, periods), args...).Result()
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to consume quota: %w", err)
+	}
+
+	fields, err := int64Slice(result, len(periods)+1)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return fields[0] == 1, fields[1:], nil
+}
+
+// QuotaUsage возвращает значения счетчиков квот
+func (r *QuotaRepository) QuotaUsage(_ context.Context, key string, periods []model.QuotaPeriod) ([]int64, error) {
+	values, err := r.client.MGet(quotaKeys(key, periods)...).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota usage: %w", err)
+	}
+
+	counts := make([]int64, len(values))
+	for i, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		if counts[i], err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("failed to parse quota usage: %w", err)
+		}
+	}
+	return counts, nil
+}
+
+// ResetQuota обнуляет счетчики квот
+func (r *QuotaRepository) ResetQuota(_ context.Context, key string, periods []model.QuotaPeriod) error {
+	if err := r.client.Del(quotaKeys(key, periods)...).Err(); err != nil {
+		return fmt.Errorf("failed to reset quota: %w", err)
+	}
+	return nil
+}
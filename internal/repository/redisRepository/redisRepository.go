@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -18,26 +19,29 @@ var (
 	// ErrRedisClientNil ошибка, если redis клиент не инициализирован
 	ErrRedisClientNil = errors.New("redis client is nil")
 	// ErrBucketNotFound ошибка, если бакет не найден
-	ErrBucketNotFound = errors.New("bucket not found")
+	ErrBucketNotFound = repository.ErrBucketNotFound
 )
 
 // BucketRepository интерфейс для работы с бакетами
 type BucketRepository struct {
-	client *redis.Client
+	client redis.UniversalClient
 }
 
-// NewRedisRepository создает новый репозиторий для работы с бакетами
-func NewRedisRepository(redis *redis.Client) (repository.BucketRepository, error) {
+// NewRedisRepository создает новый репозиторий для работы с бакетами и загружает в Redis Lua скрипты
+func NewRedisRepository(redis redis.UniversalClient) (repository.BucketRepository, error) {
 	if redis == nil {
 		return nil, ErrRedisClientNil
 	}
+	loadScripts(redis, refillScript, decreaseScript, chargeScript, updateLimitsScript, acquireScript, releaseScript)
 	return &BucketRepository{
 		client: redis,
 	}, nil
 }
 
+// bucketKey возвращает ключ бакета в Redis. Ключ клиента заключен в hash tag,
+// чтобы в Redis Cluster все данные клиента находились в одном слоте
 func bucketKey(key string) string {
-	return fmt.Sprintf("ratelimit:bucket:%s", key)
+	return fmt.Sprintf("ratelimit:bucket:{%s}", key)
 }
 
 // CreateBucket создает новый бакет
@@ -62,57 +66,37 @@ func (r *BucketRepository) CreateBucket(_ context.Context, key string, capacity
 	return nil
 }
 
-// RefillAllBuckets пополняет все бакеты токенами
+// RefillAllBuckets пополняет все бакеты токенами.
+// В Redis Cluster бакеты пополняются на каждом мастере отдельно
 func (r *BucketRepository) RefillAllBuckets(ctx context.Context) error {
-	var cursor uint64
 	now := time.Now().Unix()
 
-	script := `
-        local current_tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
-        local capacity = tonumber(redis.call('HGET', KEYS[1], 'capacity'))
-        local refil_rate = tonumber(redis.call('HGET', KEYS[1], 'refil_rate'))
-        local last_refill = tonumber(redis.call('HGET', KEYS[1], 'last_refill'))
-        
-        if not (current_tokens and capacity and refil_rate and last_refill) then
-            return 0
-        end
-        
-        local elapsed = tonumber(ARGV[1]) - last_refill
-        local added_tokens = math.floor(elapsed * refil_rate)
-        local new_tokens = math.min(capacity, current_tokens + added_tokens)
-        
-        if new_tokens > current_tokens then
-            redis.call('HMSET', KEYS[1],
-                'tokens', new_tokens,
-                'last_refill', ARGV[1]
-            )
-            return 1
-        end
-        return 0
-    `
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(func(node *redis.Client) error {
+			return refillBuckets(ctx, node, now)
+		})
+	}
+	return refillBuckets(ctx, r.client, now)
+}
+
+// refillBuckets пополняет бакеты, найденные на одном узле Redis
+func refillBuckets(ctx context.Context, client redis.Cmdable, now int64) error {
+	var cursor uint64
 
 	for {
-		keys, newCursor, err := r.client.Scan(cursor, "ratelimit:bucket:*", 100).Result()
+		keys, newCursor, err := client.Scan(cursor, "ratelimit:bucket:*", 100).Result()
 		if err != nil {
 			return fmt.Errorf("failed to scan redis: %w", err)
 		}
 		if len(keys) > 0 {
-			pipe := r.client.Pipeline()
-
-			for _, key := range keys {
-				pipe.Eval(script, []string{key}, now)
-			}
-
-			cmders, err := pipe.Exec()
+			cmders, err := refillPipeline(client, keys, now)
 			if err != nil {
 				return fmt.Errorf("failed to execute pipeline: %w", err)
 			}
 
-			for i, cmder := range cmders {
+			for _, cmder := range cmders {
 				if err := cmder.Err(); err != nil {
-					slog.Error("Failed to refill bucket",
-						"key", keys[i],
-						"error", err)
+					slog.Error("Failed to refill bucket", "error", err)
 				}
 			}
 		}
@@ -130,58 +114,172 @@ func (r *BucketRepository) RefillAllBuckets(ctx context.Context) error {
 	return nil
 }
 
-// Decrease уменьшает количество токенов в бакете
-func (r *BucketRepository) Decrease(_ context.Context, key string) (bool, error) {
-	script := `
-        local data = redis.call('HMGET', KEYS[1], 'tokens', 'last_refill', 'capacity', 'refil_rate')
-        if not data[1] then
-            return {err = "NOT_FOUND"}
-        end
-        
-        local current_tokens = tonumber(data[1])
-        local last_refill = tonumber(data[2])
-        local capacity = tonumber(data[3])
-        local refil_rate = tonumber(data[4])
-        
-        local now = tonumber(ARGV[1])
-        local elapsed = now - last_refill
-        
-        -- Вычисляем текущее количество токенов с учетом пополнения
-        local added_tokens = math.floor(elapsed * refil_rate)
-        local available_tokens = math.min(capacity, current_tokens + added_tokens)
-        
-        -- Проверяем, есть ли хотя бы 1 токен
-        if available_tokens >= 1 then
-            redis.call('HMSET', KEYS[1], 
-                'tokens', available_tokens - 1,
-                'last_refill', now
-            )
-            return 1
-        end
-        
-        -- Обновляем время в любом случае
-        redis.call('HSET', KEYS[1], 'last_refill', now)
-        return 0
-    `
-
-	result, err := r.client.Eval(script, []string{bucketKey(key)}, time.Now().Unix()).Result()
+// refillPipeline выполняет скрипт пополнения для keys одним pipeline через EVALSHA.
+// Если узел не знает скрипт, скрипт загружается и pipeline повторяется
+func refillPipeline(client redis.Cmdable, keys []string, now int64) ([]redis.Cmder, error) {
+	exec := func() ([]redis.Cmder, error) {
+		pipe := client.Pipeline()
+		for _, key := range keys {
+			refillScript.EvalSha(pipe, []string{key}, now)
+		}
+		return pipe.Exec()
+	}
+
+	cmders, err := exec()
+	if isNoScript(err) {
+		if err := refillScript.Load(client).Err(); err != nil {
+			return nil, fmt.Errorf("failed to load refill script: %w", err)
+		}
+		cmders, err = exec()
+	}
+	return cmders, err
+}
+
+// Decrease списывает cost токенов, если их хватает, и возвращает состояние бакета после списания
+func (r *BucketRepository) Decrease(_ context.Context, key string, cost int) (bool, *model.Bucket, error) {
+	now := time.Now()
+	result, err := decreaseScript.Run(r.client, []string{bucketKey(key)}, now.Unix(), cost).Result()
+	if err != nil {
+		if err.Error() == "NOT_FOUND" {
+			return false, nil, ErrBucketNotFound
+		}
+		return false, nil, fmt.Errorf("failed to decrease tokens: %w", err)
+	}
+
+	fields, err := int64Slice(result, 4)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return fields[0] == 1, &model.Bucket{
+		Tokens:     int(fields[1]),
+		Capacity:   int(fields[2]),
+		RefilRate:  int(fields[3]),
+		LastRefill: time.Unix(now.Unix(), 0),
+	}, nil
+}
+
+// Charge списывает n токенов, даже если их не хватает
+func (r *BucketRepository) Charge(_ context.Context, key string, n int) (*model.Bucket, error) {
+	now := time.Now()
+	result, err := chargeScript.Run(r.client, []string{bucketKey(key)}, now.Unix(), n).Result()
+	if err != nil {
+		if err.Error() == "NOT_FOUND" {
+			return nil, ErrBucketNotFound
+		}
+		return nil, fmt.Errorf("failed to charge tokens: %w", err)
+	}
+
+	fields, err := int64Slice(result, 3)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Bucket{
+		Tokens:     int(fields[0]),
+		Capacity:   int(fields[1]),
+		RefilRate:  int(fields[2]),
+		LastRefill: time.Unix(now.Unix(), 0),
+	}, nil
+}
+
+// UpdateBucketLimits обновляет емкость и скорость пополнения существующего бакета
+func (r *BucketRepository) UpdateBucketLimits(_ context.Context, key string, capacity int, refilRate int) error {
+	err := updateLimitsScript.Run(r.client, []string{bucketKey(key)}, capacity, refilRate).Err()
 	if err != nil {
-		return false, fmt.Errorf("failed to decrease tokens: %w", err)
+		return fmt.Errorf("failed to update bucket limits: %w", err)
 	}
+	return nil
+}
+
+// UpdateAllBucketLimits обновляет емкость и скорость пополнения всех бакетов, кроме пропущенных skip.
+// В Redis Cluster бакеты обходятся на каждом мастере отдельно
+func (r *BucketRepository) UpdateAllBucketLimits(ctx context.Context, capacity int, refilRate int, skip func(key string) bool) error {
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		return cluster.ForEachMaster(func(node *redis.Client) error {
+			return updateAllLimits(ctx, node, capacity, refilRate, skip)
+		})
+	}
+	return updateAllLimits(ctx, r.client, capacity, refilRate, skip)
+}
 
-	switch v := result.(type) {
-	case int64:
-		return v == 1, nil
-	case []interface{}:
-		if len(v) > 0 {
-			if errMsg, ok := v[0].(string); ok && errMsg == "NOT_FOUND" {
-				return false, ErrBucketNotFound
+// updateAllLimits обновляет лимиты бакетов, найденных на одном узле Redis
+func updateAllLimits(ctx context.Context, client redis.Cmdable, capacity int, refilRate int, skip func(key string) bool) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(cursor, "ratelimit:bucket:*", 100).Result()
+		if err != nil {
+			return fmt.Errorf("failed to scan redis: %w", err)
+		}
+		for _, key := range keys {
+			clientKey := strings.TrimSuffix(strings.TrimPrefix(key, "ratelimit:bucket:{"), "}")
+			if skip(clientKey) {
+				continue
 			}
+			if err := updateLimitsScript.Run(client, []string{key}, capacity, refilRate).Err(); err != nil {
+				return fmt.Errorf("failed to update bucket limits: %w", err)
+			}
+		}
+
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("context cancelled: %w", err)
+		}
+	}
+}
+
+// Acquire списывает из бакета до n токенов с учетом пополнения и возвращает количество списанных токенов
+func (r *BucketRepository) Acquire(_ context.Context, key string, n int) (int, *model.Bucket, error) {
+	now := time.Now()
+	result, err := acquireScript.Run(r.client, []string{bucketKey(key)}, now.Unix(), n).Result()
+	if err != nil {
+		if err.Error() == "NOT_FOUND" {
+			return 0, nil, ErrBucketNotFound
+		}
+		return 0, nil, fmt.Errorf("failed to acquire tokens: %w", err)
+	}
+
+	fields, err := int64Slice(result, 4)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return int(fields[0]), &model.Bucket{
+		Tokens:     int(fields[1]),
+		Capacity:   int(fields[2]),
+		RefilRate:  int(fields[3]),
+		LastRefill: time.Unix(now.Unix(), 0),
+	}, nil
+}
+
+// Release возвращает в бакет неиспользованные токены, не превышая его емкость
+func (r *BucketRepository) Release(_ context.Context, key string, n int) error {
+
+	if err := releaseScript.Run(r.client, []string{bucketKey(key)}, n).Err(); err != nil {
+		return fmt.Errorf("failed to release tokens: %w", err)
+	}
+	return nil
+}
+
+// int64Slice преобразует ответ Lua скрипта в срез чисел длины size
+func int64Slice(result interface{}, size int) ([]int64, error) {
+	values, ok := result.([]interface{})
+	if !ok || len(values) != size {
+		return nil, fmt.Errorf("unexpected result format: %v", result)
+	}
+
+	fields := make([]int64, len(values))
+	for i, v := range values {
+		n, ok := v.(int64)
+		if !ok {
+			return nil, fmt.Errorf("unexpected result type: %T", v)
 		}
-		return false, fmt.Errorf("unexpected result format: %v", v)
-	default:
-		return false, fmt.Errorf("unexpected result type: %T", result)
+		fields[i] = n
 	}
+	return fields, nil
 }
 
 // Bucket возвращает бакет по ключу
@@ -192,7 +290,7 @@ func (r *BucketRepository) Bucket(_ context.Context, key string) (*model.Bucket,
 		return nil, fmt.Errorf("failed to get bucket: %w", err)
 	}
 	if len(result) == 0 {
-		slog.Debug("Bucket not found", "key", key)
+		slog.Debug("Bucket not found")
 		return nil, ErrBucketNotFound
 	}
 
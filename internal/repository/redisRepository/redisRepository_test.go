@@ -0,0 +1,277 @@
+package redisRepository
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vakhrushevk/cloudru/internal/config"
+	"github.com/vakhrushevk/cloudru/internal/metrics"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+	"github.com/vakhrushevk/cloudru/internal/repository/model"
+)
+
+func newTestClient(tb testing.TB) *redis.Client {
+	server := miniredis.RunT(tb)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	tb.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestDecreaseReloadsScript(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	repo, err := NewRedisRepository(client)
+	require.NoError(t, err)
+
+	exists, err := decreaseScript.Exists(client).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []bool{true}, exists, "script is loaded at construction")
+
+	require.NoError(t, repo.CreateBucket(ctx, "k", 10, 0, 2))
+	require.NoError(t, client.ScriptFlush().Err())
+
+	ok, b, err := repo.Decrease(ctx, "k", 1)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, b.Tokens)
+
+	_, _, err = repo.Decrease(ctx, "missing", 1)
+	assert.ErrorIs(t, err, ErrBucketNotFound)
+}
+
+func TestRefillReloadsScript(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	repo, err := NewRedisRepository(client)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateBucket(ctx, "k", 10, 1, 0))
+	require.NoError(t, client.HSet(bucketKey("k"), "last_refill", time.Now().Add(-5*time.Second).Unix()).Err())
+	require.NoError(t, client.ScriptFlush().Err())
+
+	require.NoError(t, repo.RefillAllBuckets(ctx))
+
+	b, err := repo.Bucket(ctx, "k")
+	require.NoError(t, err)
+	assert.Equal(t, 5, b.Tokens)
+}
+
+func TestBanEscalates(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	repo, err := NewBanRepository(client)
+	require.NoError(t, err)
+
+	// expire завершает блокировку клиента, сохраняя ее в истории до forget
+	expire := func(key string, forget int64) {
+		raw, err := client.HGet(bansKey, key).Result()
+		require.NoError(t, err)
+		var record banRecord
+		require.NoError(t, json.Unmarshal([]byte(raw), &record))
+		record.Expires, record.Forget = time.Now().Unix()-1, forget
+		data, err := json.Marshal(record)
+		require.NoError(t, err)
+		require.NoError(t, client.HSet(bansKey, key, data).Err())
+	}
+
+	durations := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute}
+	for i, want := range durations {
+		ban, err := repo.Ban(ctx, "ip:10.0.0.1", time.Minute, 5*time.Minute, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, i+1, ban.Strikes)
+		assert.WithinDuration(t, time.Now().Add(want), ban.Until, 2*time.Second)
+
+		// нарушения во время действующей блокировки ее не продлевают
+		again, err := repo.Ban(ctx, "ip:10.0.0.1", time.Minute, 5*time.Minute, time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, ban, again)
+
+		if i < len(durations)-1 {
+			expire("ip:10.0.0.1", time.Now().Add(time.Hour).Unix())
+		}
+	}
+
+	bans, err := repo.Bans(ctx)
+	require.NoError(t, err)
+	require.Len(t, bans, 1)
+	assert.Equal(t, 4, bans[0].Strikes)
+
+	require.NoError(t, repo.Unban(ctx, "ip:10.0.0.1"))
+	assert.ErrorIs(t, repo.Unban(ctx, "ip:10.0.0.1"), repository.ErrBanNotFound)
+}
+
+func TestBansCleanup(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+
+	repo, err := NewBanRepository(client)
+	require.NoError(t, err)
+
+	_, err = repo.Ban(ctx, "ip:10.0.0.1", time.Minute, time.Hour, time.Hour)
+	require.NoError(t, err)
+	_, err = repo.Ban(ctx, "ip:10.0.0.2", time.Minute, time.Hour, time.Hour)
+	require.NoError(t, err)
+	forgotten, err := json.Marshal(banRecord{Expires: 1, Forget: 2, Strikes: 1})
+	require.NoError(t, err)
+	require.NoError(t, client.HSet(bansKey, "ip:10.0.0.2", forgotten).Err())
+	require.NoError(t, client.HSet(bansKey, "ip:10.0.0.3", "not json").Err())
+
+	bans, err := repo.Bans(ctx)
+	require.NoError(t, err, "corrupt record does not fail the sync")
+	require.Len(t, bans, 1)
+	assert.Equal(t, "ip:10.0.0.1", bans[0].Key)
+
+	keys, err := client.HKeys(bansKey).Result()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"ip:10.0.0.1", "ip:10.0.0.3"}, keys, "forgotten ban is deleted")
+}
+
+// BenchmarkDecrease сравнивает передачу исходного кода скрипта через EVAL с вызовом через EVALSHA
+func BenchmarkDecrease(b *testing.B) {
+	client := newTestClient(b)
+	require.NoError(b, client.HMSet(bucketKey("k"), map[string]interface{}{
+		"tokens": 1 << 30, "capacity": 1 << 30, "refil_rate": 0, "last_refill": time.Now().Unix(),
+	}).Err())
+	require.NoError(b, decreaseScript.Load(client).Err())
+	keys := []string{bucketKey("k")}
+
+	b.Run("eval", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := decreaseScript.Eval(client, keys, time.Now().Unix(), 1).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("evalsha", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if err := decreaseScript.Run(client, keys, time.Now().Unix(), 1).Err(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestNewClient(t *testing.T) {
+	server := miniredis.RunT(t)
+	dir := t.TempDir()
+	emptyCA := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(emptyCA, []byte("not a certificate"), 0o600))
+
+	tests := []struct {
+		name    string
+		cfg     config.RedisConfig
+		wantErr string
+	}{
+		{name: "single", cfg: config.RedisConfig{Addr: server.Addr()}},
+		{name: "single from addrs", cfg: config.RedisConfig{Mode: ModeSingle, Addrs: []string{server.Addr()}}},
+		{name: "sentinel without master_name", cfg: config.RedisConfig{Mode: ModeSentinel, Addrs: []string{"sentinel:26379"}}, wantErr: "sentinel mode requires master_name and addrs"},
+		{name: "sentinel without addrs", cfg: config.RedisConfig{Mode: ModeSentinel, MasterName: "mymaster"}, wantErr: "sentinel mode requires master_name and addrs"},
+		{name: "cluster without addrs", cfg: config.RedisConfig{Mode: ModeCluster}, wantErr: "cluster mode requires addrs"},
+		{name: "cluster with db", cfg: config.RedisConfig{Mode: ModeCluster, Addrs: []string{"node:6379"}, DB: 1}, wantErr: "cluster mode supports only db 0"},
+		{name: "unknown mode", cfg: config.RedisConfig{Mode: "replica", Addr: server.Addr()}, wantErr: `unknown mode "replica"`},
+		{name: "missing CA file", cfg: config.RedisConfig{Addr: server.Addr(), TLS: config.RedisTLSConfig{Enabled: true, CAFile: filepath.Join(dir, "missing.pem")}}, wantErr: "failed to read redis CA file"},
+		{name: "CA file without certificates", cfg: config.RedisConfig{Addr: server.Addr(), TLS: config.RedisTLSConfig{Enabled: true, CAFile: emptyCA}}, wantErr: "no certificates in"},
+		{name: "client certificate without key", cfg: config.RedisConfig{Addr: server.Addr(), TLS: config.RedisTLSConfig{Enabled: true, CertFile: emptyCA}}, wantErr: "failed to load redis client certificate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewClient(tt.cfg)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			t.Cleanup(func() { client.Close() })
+			assert.NoError(t, client.Ping().Err())
+		})
+	}
+}
+
+// hashTag возвращает часть ключа, по которой Redis Cluster выбирает слот
+func hashTag(key string) string {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			return key[start+1 : start+1+end]
+		}
+	}
+	return key
+}
+
+func TestKeysShareHashTag(t *testing.T) {
+	periods := []model.QuotaPeriod{{ID: "day:2024-05-01"}, {ID: "month:2024-05"}}
+	for _, key := range []string{"ip:10.0.0.1", "policy:login:header:x-api-key:abc", "cookie:{session}"} {
+		t.Run(key, func(t *testing.T) {
+			tag := hashTag(bucketKey(key))
+			assert.Contains(t, key, tag)
+			assert.Equal(t, tag, hashTag(concurrencyKey(key)))
+			assert.Equal(t, tag, hashTag(windowKey(key)))
+			// ключи всех периодов квоты обрабатываются одним скриптом и должны быть в одном слоте
+			for _, k := range quotaKeys(key, periods) {
+				assert.Equal(t, tag, hashTag(k))
+			}
+		})
+	}
+	assert.Equal(t, "ip:10.0.0.1", hashTag(bucketKey("ip:10.0.0.1")))
+}
+
+// redisOperations возвращает количество операций Redis operation с результатом result в reg
+func redisOperations(t *testing.T, reg *prometheus.Registry, operation, result string) uint64 {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, f := range families {
+		if f.GetName() != "cloudru_redis_operation_duration_seconds" {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			labels := make(map[string]string)
+			for _, l := range m.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+			if labels["operation"] == operation && labels["result"] == result {
+				return m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return 0
+}
+
+func TestInstrumentedClient(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client, err := NewClient(config.RedisConfig{Addr: server.Addr()})
+	require.NoError(t, err)
+	t.Cleanup(func() { client.Close() })
+	reg := prometheus.NewRegistry()
+	require.NoError(t, metrics.Register(reg))
+
+	repo, err := NewRedisRepository(client)
+	require.NoError(t, err)
+	require.NoError(t, repo.CreateBucket(ctx, "k", 10, 0, 2))
+
+	ok := redisOperations(t, reg, "script:decrease", "ok")
+	_, _, err = repo.Decrease(ctx, "k", 1)
+	require.NoError(t, err)
+	assert.Equal(t, ok+1, redisOperations(t, reg, "script:decrease", "ok"))
+
+	// после SCRIPT FLUSH скрипт выполняется через EVAL и учитывается под тем же именем
+	failed := redisOperations(t, reg, "script:decrease", "error")
+	require.NoError(t, client.ScriptFlush().Err())
+	_, _, err = repo.Decrease(ctx, "k", 1)
+	require.NoError(t, err)
+	assert.Equal(t, ok+2, redisOperations(t, reg, "script:decrease", "ok"))
+	assert.Equal(t, failed+1, redisOperations(t, reg, "script:decrease", "error"))
+}
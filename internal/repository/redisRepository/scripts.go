@@ -0,0 +1,291 @@
+package redisRepository
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// Lua скрипты загружаются в Redis при создании репозитория и вызываются через EVALSHA.
+// Если Redis не знает скрипт (перезапуск, переключение мастера, SCRIPT FLUSH),
+// Script.Run выполняет его через EVAL, и Redis снова кэширует скрипт.
+var (
+	// refillScript пополняет бакет за время, прошедшее с последнего пополнения
+	refillScript = newScript("refill", `
+        local current_tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+        local capacity = tonumber(redis.call('HGET', KEYS[1], 'capacity'))
+        local refil_rate = tonumber(redis.call('HGET', KEYS[1], 'refil_rate'))
+        local last_refill = tonumber(redis.call('HGET', KEYS[1], 'last_refill'))
+        
+        if not (current_tokens and capacity and refil_rate and last_refill) then
+            return 0
+        end
+        
+        local elapsed = tonumber(ARGV[1]) - last_refill
+        local added_tokens = math.floor(elapsed * refil_rate)
+        local new_tokens = math.min(capacity, current_tokens + added_tokens)
+        
+        if new_tokens > current_tokens then
+            redis.call('HMSET', KEYS[1],
+                'tokens', new_tokens,
+                'last_refill', ARGV[1]
+            )
+            return 1
+        end
+        return 0
+    `)
+
+	// decreaseScript пополняет бакет и списывает ARGV[2] токенов, если их хватает. Возвращает {allowed, tokens, capacity, refil_rate}
+	decreaseScript = newScript("decrease", `
+        local data = redis.call('HMGET', KEYS[1], 'tokens', 'last_refill', 'capacity', 'refil_rate')
+        if not data[1] then
+            return {err = "NOT_FOUND"}
+        end
+        
+        local current_tokens = tonumber(data[1])
+        local last_refill = tonumber(data[2])
+        local capacity = tonumber(data[3])
+        local refil_rate = tonumber(data[4])
+        
+        local now = tonumber(ARGV[1])
+        local cost = tonumber(ARGV[2])
+        local elapsed = now - last_refill
+        
+        -- Вычисляем текущее количество токенов с учетом пополнения
+        local added_tokens = math.floor(elapsed * refil_rate)
+        local available_tokens = math.min(capacity, current_tokens + added_tokens)
+        
+        -- Проверяем, хватает ли токенов на стоимость запроса
+        if available_tokens >= cost then
+            redis.call('HMSET', KEYS[1], 
+                'tokens', available_tokens - cost,
+                'last_refill', now
+            )
+            return {1, available_tokens - cost, capacity, refil_rate}
+        end
+        
+        -- Обновляем время в любом случае
+        redis.call('HMSET', KEYS[1],
+            'tokens', available_tokens,
+            'last_refill', now
+        )
+        return {0, available_tokens, capacity, refil_rate}
+    `)
+
+	// chargeScript пополняет бакет и списывает ARGV[2] токенов, даже если их не хватает:
+	// бакет уходит в минус и пополняется дольше. Возвращает {tokens, capacity, refil_rate}
+	chargeScript = newScript("charge", `
+        local data = redis.call('HMGET', KEYS[1], 'tokens', 'last_refill', 'capacity', 'refil_rate')
+        if not data[1] then
+            return {err = "NOT_FOUND"}
+        end
+
+        local capacity = tonumber(data[3])
+        local refil_rate = tonumber(data[4])
+        local now = tonumber(ARGV[1])
+        local added_tokens = math.floor((now - tonumber(data[2])) * refil_rate)
+        local tokens = math.min(capacity, tonumber(data[1]) + added_tokens) - tonumber(ARGV[2])
+
+        redis.call('HMSET', KEYS[1],
+            'tokens', tokens,
+            'last_refill', now
+        )
+        return {tokens, capacity, refil_rate}
+    `)
+
+	// updateLimitsScript обновляет емкость и скорость пополнения существующего бакета
+	updateLimitsScript = newScript("update_limits", `
+        if redis.call('EXISTS', KEYS[1]) == 0 then
+            return 0
+        end
+        local capacity = tonumber(ARGV[1])
+        local tokens = tonumber(redis.call('HGET', KEYS[1], 'tokens'))
+        redis.call('HMSET', KEYS[1],
+            'capacity', capacity,
+            'refil_rate', ARGV[2],
+            'tokens', math.min(tokens, capacity)
+        )
+        return 1
+    `)
+
+	// acquireScript пополняет бакет и списывает до ARGV[2] токенов. Возвращает {granted, tokens, capacity, refil_rate}
+	acquireScript = newScript("acquire", `
+        local data = redis.call('HMGET', KEYS[1], 'tokens', 'last_refill', 'capacity', 'refil_rate')
+        if not data[1] then
+            return {err = "NOT_FOUND"}
+        end
+
+        local current_tokens = tonumber(data[1])
+        local last_refill = tonumber(data[2])
+        local capacity = tonumber(data[3])
+        local refil_rate = tonumber(data[4])
+
+        local now = tonumber(ARGV[1])
+        local added_tokens = math.floor((now - last_refill) * refil_rate)
+        local available_tokens = math.min(capacity, current_tokens + added_tokens)
+        local granted = math.max(0, math.min(available_tokens, tonumber(ARGV[2])))
+
+        redis.call('HMSET', KEYS[1],
+            'tokens', available_tokens - granted,
+            'last_refill', now
+        )
+        return {granted, available_tokens - granted, capacity, refil_rate}
+    `)
+
+	// releaseScript возвращает в бакет ARGV[1] токенов, не превышая его емкость
+	releaseScript = newScript("release", `
+        local data = redis.call('HMGET', KEYS[1], 'tokens', 'capacity')
+        if not data[1] then
+            return 0
+        end
+        local tokens = math.min(tonumber(data[2]), tonumber(data[1]) + tonumber(ARGV[1]))
+        redis.call('HSET', KEYS[1], 'tokens', tokens)
+        return 1
+    `)
+
+	// acquireSlotScript удаляет истекшие слоты и занимает или продлевает слот ARGV[1]. Возвращает {acquired, in_flight}
+	acquireSlotScript = newScript("acquire_slot", `
+        local now = tonumber(ARGV[2])
+        redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now)
+
+        local count = redis.call('ZCARD', KEYS[1])
+        if not redis.call('ZSCORE', KEYS[1], ARGV[1]) then
+            if count >= tonumber(ARGV[3]) then
+                return {0, count}
+            end
+            count = count + 1
+        end
+
+        redis.call('ZADD', KEYS[1], now + tonumber(ARGV[4]), ARGV[1])
+        redis.call('PEXPIRE', KEYS[1], ARGV[4])
+        return {1, count}
+    `)
+
+	// consumeQuotaScript увеличивает счетчики квот KEYS, если ни одна квота не исчерпана.
+	// ARGV - пары лимит и время окончания периода в секундах. Возвращает {allowed, count...}
+	consumeQuotaScript = newScript("consume_quota", `
+        local counts = {}
+        local allowed = 1
+        for i, key in ipairs(KEYS) do
+            counts[i] = tonumber(redis.call('GET', key) or '0')
+            if counts[i] >= tonumber(ARGV[2 * i - 1]) then
+                allowed = 0
+            end
+        end
+
+        if allowed == 1 then
+            for i, key in ipairs(KEYS) do
+                counts[i] = redis.call('INCR', key)
+                if counts[i] == 1 then
+                    redis.call('EXPIREAT', key, ARGV[2 * i])
+                end
+            end
+        end
+
+        table.insert(counts, 1, allowed)
+        return counts
+    `)
+
+	// banScript блокирует клиента ARGV[1] в хэше KEYS[1]. ARGV: now, duration, max_duration, reset в секундах.
+	// Длительность удваивается за каждую предыдущую блокировку, которая еще не забыта.
+	// Действующая блокировка не продлевается. Возвращает {expires, strikes}
+	banScript = newScript("ban", `
+        local now = tonumber(ARGV[2])
+        local duration = tonumber(ARGV[3])
+        local max_duration = tonumber(ARGV[4])
+
+        local strikes = 0
+        local raw = redis.call('HGET', KEYS[1], ARGV[1])
+        if raw then
+            local ok, ban = pcall(cjson.decode, raw)
+            if ok and type(ban) == 'table' then
+                if tonumber(ban.expires) and ban.expires > now then
+                    return {ban.expires, ban.strikes}
+                end
+                if tonumber(ban.forget) and ban.forget > now then
+                    strikes = ban.strikes
+                end
+            end
+        end
+
+        for i = 1, strikes do
+            if duration >= max_duration then
+                break
+            end
+            duration = duration * 2
+        end
+        duration = math.min(duration, max_duration)
+
+        strikes = strikes + 1
+        local expires = now + duration
+        redis.call('HSET', KEYS[1], ARGV[1], cjson.encode({
+            expires = expires,
+            forget = expires + tonumber(ARGV[5]),
+            strikes = strikes,
+        }))
+        return {expires, strikes}
+    `)
+
+	// bansScript удаляет из хэша KEYS[1] блокировки, забытые к моменту ARGV[1] в секундах,
+	// и возвращает остальные записи в формате HGETALL
+	bansScript = newScript("bans", `
+        local now = tonumber(ARGV[1])
+        local entries = redis.call('HGETALL', KEYS[1])
+        local result = {}
+        for i = 1, #entries, 2 do
+            local ok, ban = pcall(cjson.decode, entries[i + 1])
+            if ok and type(ban) == 'table' and tonumber(ban.forget) and ban.forget <= now then
+                redis.call('HDEL', KEYS[1], entries[i])
+            else
+                table.insert(result, entries[i])
+                table.insert(result, entries[i + 1])
+            end
+        end
+        return result
+    `)
+
+	// incrementScript увеличивает счетчик окна на ARGV[2] и возвращает {count, ttl}
+	incrementScript = newScript("increment", `
+        local count = redis.call('INCRBY', KEYS[1], ARGV[2])
+        if count == tonumber(ARGV[2]) then
+            redis.call('PEXPIRE', KEYS[1], ARGV[1])
+        end
+        local ttl = redis.call('PTTL', KEYS[1])
+        if ttl < 0 then
+            redis.call('PEXPIRE', KEYS[1], ARGV[1])
+            ttl = tonumber(ARGV[1])
+        end
+        return {count, ttl}
+    `)
+)
+
+// loadScripts загружает скрипты в Redis, в Redis Cluster на каждый мастер.
+// Ошибка не мешает работе: скрипты будут загружены при первом вызове
+func loadScripts(client redis.UniversalClient, scripts ...*redis.Script) {
+	load := func(c redis.Cmdable) error {
+		for _, script := range scripts {
+			if err := script.Load(c).Err(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if cluster, ok := client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(func(node *redis.Client) error {
+			return load(node)
+		})
+	} else {
+		err = load(client)
+	}
+	if err != nil {
+		slog.Warn("Failed to preload redis scripts", "error", err)
+	}
+}
+
+// isNoScript проверяет, что Redis не нашел скрипт по SHA1
+func isNoScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
+}
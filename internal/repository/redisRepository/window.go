@@ -0,0 +1,47 @@
+package redisRepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/vakhrushevk/cloudru/internal/repository"
+)
+
+// WindowRepository реализация repository.WindowRepository в Redis
+type WindowRepository struct {
+	client redis.UniversalClient
+}
+
+// NewWindowRepository создает новый репозиторий счетчиков фиксированного окна
+func NewWindowRepository(redis redis.UniversalClient) (repository.WindowRepository, error) {
+	if redis == nil {
+		return nil, ErrRedisClientNil
+	}
+	loadScripts(redis, incrementScript)
+	return &WindowRepository{
+		client: redis,
+	}, nil
+}
+
+// windowKey возвращает ключ счетчика окна в Redis, ключ клиента заключен в hash tag, как у бакета
+func windowKey(key string) string {
+	return fmt.Sprintf("ratelimit:window:{%s}", key)
+}
+
+// Increment увеличивает счетчик окна на n. Окно начинается с первого запроса и живет window
+func (r *WindowRepository) Increment(_ context.Context, key string, n int, window time.Duration) (int, time.Duration, error) {
+
+	result, err := incrementScript.Run(r.client, []string{windowKey(key)}, window.Milliseconds(), n).Result()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to increment window: %w", err)
+	}
+
+	fields, err := int64Slice(result, 2)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return int(fields[0]), time.Duration(fields[1]) * time.Millisecond, nil
+}
@@ -4,6 +4,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/vakhrushevk/cloudru/internal/repository/model"
 )
@@ -11,12 +12,76 @@ import (
 var (
 	// ErrBucketNotFound ошибка, если бакет не найден
 	ErrBucketNotFound = errors.New("bucket not found")
+	// ErrStoreUnavailable ошибка, если хранилище недоступно
+	ErrStoreUnavailable = errors.New("store unavailable")
+	// ErrOverrideNotFound ошибка, если переопределение лимитов не найдено
+	ErrOverrideNotFound = errors.New("override not found")
+	// ErrBanNotFound ошибка, если блокировка клиента не найдена
+	ErrBanNotFound = errors.New("ban not found")
 )
 
 // BucketRepository интерфейс для работы с бакетами
 type BucketRepository interface {
 	CreateBucket(ctx context.Context, key string, capacity int, refilRate int, tokens int) error
 	Bucket(ctx context.Context, key string) (*model.Bucket, error)
-	Decrease(ctx context.Context, key string) (bool, error)
+	// Decrease списывает cost токенов, если их хватает, и возвращает состояние бакета после списания
+	Decrease(ctx context.Context, key string, cost int) (bool, *model.Bucket, error)
+	// Charge списывает n токенов, даже если их не хватает, количество токенов может стать отрицательным
+	Charge(ctx context.Context, key string, n int) (*model.Bucket, error)
 	RefillAllBuckets(ctx context.Context) error
+	UpdateBucketLimits(ctx context.Context, key string, capacity int, refilRate int) error
+	// UpdateAllBucketLimits обновляет емкость и скорость пополнения всех бакетов, кроме тех, для ключей которых skip возвращает true
+	UpdateAllBucketLimits(ctx context.Context, capacity int, refilRate int, skip func(key string) bool) error
+	// Acquire списывает из бакета до n токенов и возвращает количество списанных токенов
+	Acquire(ctx context.Context, key string, n int) (int, *model.Bucket, error)
+	// Release возвращает в бакет n неиспользованных токенов, не превышая емкость
+	Release(ctx context.Context, key string, n int) error
+}
+
+// WindowRepository интерфейс для работы со счетчиками фиксированного окна
+type WindowRepository interface {
+	// Increment увеличивает счетчик окна на n и возвращает его значение и время до сброса окна
+	Increment(ctx context.Context, key string, n int, window time.Duration) (int, time.Duration, error)
+}
+
+// ConcurrencyRepository интерфейс для учета одновременных запросов клиента.
+// Каждый запрос занимает слот с идентификатором lease, который освобождается сам через ttl,
+// если экземпляр балансировщика завершился, не вернув слот
+type ConcurrencyRepository interface {
+	// AcquireSlot занимает слот, если занято меньше limit слотов, или продлевает уже занятый слот lease.
+	// Возвращает, занят ли слот, и количество занятых слотов
+	AcquireSlot(ctx context.Context, key string, lease string, limit int, ttl time.Duration) (bool, int, error)
+	// ReleaseSlot освобождает слот lease
+	ReleaseSlot(ctx context.Context, key string, lease string) error
+}
+
+// QuotaRepository интерфейс для работы со счетчиками квот за длительные периоды
+type QuotaRepository interface {
+	// ConsumeQuota атомарно увеличивает счетчики всех периодов, если ни одна квота не исчерпана.
+	// Возвращает, учтен ли запрос, и значения счетчиков в порядке periods
+	ConsumeQuota(ctx context.Context, key string, periods []model.QuotaPeriod) (bool, []int64, error)
+	// QuotaUsage возвращает значения счетчиков в порядке periods
+	QuotaUsage(ctx context.Context, key string, periods []model.QuotaPeriod) ([]int64, error)
+	// ResetQuota обнуляет счетчики periods
+	ResetQuota(ctx context.Context, key string, periods []model.QuotaPeriod) error
+}
+
+// BanRepository интерфейс для работы с временными блокировками клиентов
+type BanRepository interface {
+	// Ban блокирует клиента на duration, удвоенную за каждую предыдущую блокировку подряд, но не более maxDuration.
+	// Предыдущие блокировки забываются, если после окончания последней прошло больше reset.
+	// Если клиент уже заблокирован, возвращает действующую блокировку без изменений
+	Ban(ctx context.Context, key string, duration, maxDuration, reset time.Duration) (model.Ban, error)
+	// Bans возвращает действующие блокировки
+	Bans(ctx context.Context) ([]model.Ban, error)
+	// Unban снимает блокировку клиента и забывает предыдущие блокировки
+	Unban(ctx context.Context, key string) error
+}
+
+// OverrideRepository интерфейс для работы с переопределениями лимитов
+type OverrideRepository interface {
+	SetOverride(ctx context.Context, override model.Override) error
+	Override(ctx context.Context, key string) (*model.Override, error)
+	Overrides(ctx context.Context) ([]model.Override, error)
+	DeleteOverride(ctx context.Context, key string) error
 }
@@ -2,11 +2,21 @@
 package logger
 
 import (
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"strings"
 )
 
+var (
+	// ErrUnknownLevel ошибка, если уровень логирования не поддерживается
+	ErrUnknownLevel = errors.New("unknown log level")
+)
+
+// level текущий уровень логирования, изменяется без пересоздания логгера
+var level = new(slog.LevelVar)
+
 // ConfigLogger определяет интерфейс конфигурации логгера
 // Level() - уровень логирования (debug, info, warn, error)
 // Format() - формат вывода (json, text)
@@ -19,19 +29,19 @@ type ConfigLogger interface {
 
 // Init инициализирует slog и возвращает логгер, устанавливая его глобально
 func Init(config ConfigLogger) *slog.Logger {
-	level := parseLevel(config.Level())
+	level.Set(parseLevel(config.Level()))
 
 	var handler slog.Handler
 	switch strings.ToLower(config.Format()) {
 	case "text":
 		handler = slog.NewTextHandler(config.Output(), &slog.HandlerOptions{
 			Level:     level,
-			AddSource: level == slog.LevelDebug,
+			AddSource: level.Level() == slog.LevelDebug,
 		})
 	default:
 		handler = slog.NewJSONHandler(config.Output(), &slog.HandlerOptions{
 			Level:     level,
-			AddSource: level == slog.LevelDebug,
+			AddSource: level.Level() == slog.LevelDebug,
 		})
 	}
 
@@ -41,6 +51,22 @@ func Init(config ConfigLogger) *slog.Logger {
 	return logger
 }
 
+// Level возвращает текущий уровень логирования: debug, info, warn или error
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// SetLevel изменяет уровень логирования до следующей инициализации логгера
+func SetLevel(name string) error {
+	switch strings.ToLower(name) {
+	case "debug", "info", "warn", "warning", "error":
+		level.Set(parseLevel(name))
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownLevel, name)
+	}
+}
+
 // parseLevel преобразует строку уровня в slog.Level
 func parseLevel(level string) slog.Level {
 	switch strings.ToLower(level) {